@@ -0,0 +1,14 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+
+package main
+
+import "os"
+
+// canExecute returns true if the file at path has any execute bit set, since
+// there is no access(2) to check the current user's permission.
+func canExecute(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && isExecutable(info.Mode())
+}
@@ -0,0 +1,14 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+
+package main
+
+import "syscall"
+
+// canExecute returns true if the current user has permission to execute the
+// file at path. Unlike isExecutable, it takes ownership into account.
+func canExecute(path string) bool {
+	const xOK = 1
+	return syscall.Access(path, xOK) == nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+func (c *command) adopt(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	yes := opts.bool('y', "yes")
+	sources := opts.strings('s', "source")
+	c.validate(opts, anyArgs)
+	roots := c.sourceRoots(sources)
+	if len(roots) == 0 {
+		c.fatal("%s: no source roots (use --source or sim sources add)", c.name)
+	}
+	// Find regular files in the bin directory, optionally only those named.
+	only := make(map[string]bool)
+	for _, name := range opts.args {
+		only[name] = true
+	}
+	copies := make(map[int64][]string)
+	for _, file := range c.files() {
+		if skip(file) || !file.Type().IsRegular() || len(only) > 0 && !only[file.Name()] {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			c.error("%s: %s", file.Name(), err)
+			continue
+		}
+		copies[info.Size()] = append(copies[info.Size()], file.Name())
+	}
+	// Map each copy to an identical source, preferring ones with the same name.
+	sums := make(map[string]string)
+	sumOf := func(path string) string {
+		if _, ok := sums[path]; !ok {
+			sums[path], _ = checksum(path)
+		}
+		return sums[path]
+	}
+	found := make(map[string]string)
+	c.walkSources(roots, func(path string, info fs.FileInfo) {
+		for _, name := range copies[info.Size()] {
+			if prev, ok := found[name]; ok && (filepath.Base(prev) == name || filepath.Base(path) != name) {
+				continue
+			}
+			if sumOf(path) != "" && sumOf(path) == sumOf(filepath.Join(c.bin(), name)) {
+				found[name] = path
+			}
+		}
+	})
+	for _, file := range c.files() {
+		if source, ok := found[file.Name()]; ok {
+			c.adoptProgram(file.Name(), source, dryRun, yes)
+		}
+	}
+	for name := range only {
+		if _, ok := found[name]; !ok {
+			c.error("%s: no identical file found in source roots", name)
+		}
+	}
+}
+
+// adoptProgram replaces a copied program with a symlink to source.
+func (c *command) adoptProgram(name, source string, dryRun, yes bool) {
+	path := filepath.Join(c.bin(), name)
+	if dryRun {
+		fmt.Printf("Would adopt %s %s %s\n", name, brightBlack("->"), blue(source))
+		return
+	}
+	if !yes && !confirm("Replace %s with symlink to %s?", name, source) {
+		return
+	}
+	relTarget, err := filepath.Rel(c.bin(), source)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	fmt.Printf("Adopting %s %s %s\n", name, brightBlack("->"), blue(source))
+	if err := replaceSymlink(relTarget, path); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	c.logChange("adopt", path, relTarget)
+	p := c.state().program(name)
+	*p = programState{Pinned: p.Pinned, Mode: modeSymlink, Installed: stamp(), Resources: p.Resources}
+	p.TargetChecksum, _ = checksum(source)
+	c.modified()
+}
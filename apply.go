@@ -0,0 +1,175 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func (c *command) apply(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	prune := opts.bool('p', "prune")
+	forcePinned := opts.bool(0, "force-pinned")
+	locked := opts.bool(0, "locked")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := opts.args[0]
+	if locked && file == "-" {
+		c.fatal("%s: cannot use --locked with a manifest from stdin", c.name)
+	}
+	m := c.readManifest(file)
+	var locks map[string]lockEntry
+	if locked {
+		locks = c.readLockfile(file)
+	}
+	declared := make(map[string]bool)
+	// Programs that aliases can point to once the manifest is applied.
+	originals := make(map[string]bool)
+	for _, e := range m.Programs {
+		if e.Original == "" {
+			originals[e.Name] = true
+		}
+	}
+	var install, pins []manifestEntry
+	var replace, remove []string
+	// Number of entries that cannot be installed.
+	failed := 0
+	for _, e := range m.Programs {
+		declared[e.Name] = true
+		if _, err := os.Lstat(filepath.Join(c.bin(), e.Name)); err != nil {
+			if !locked || c.checkLocked(e, locks) {
+				install = append(install, e)
+			} else {
+				failed++
+			}
+			continue
+		}
+		if c.satisfies(e) {
+			if pinned := c.state().lookup(e.Name).pinned(); pinned == e.Pinned {
+				continue
+			} else if pinned && !forcePinned {
+				fmt.Printf("Skipping %s %s\n", e.Name, brightBlack("(pinned)"))
+				continue
+			}
+			pins = append(pins, e)
+			continue
+		}
+		if !forcePinned && c.state().lookup(e.Name).pinned() {
+			fmt.Printf("Skipping %s %s\n", e.Name, brightBlack("(pinned)"))
+			continue
+		}
+		// Check the replacement before removing anything. Aliases of programs
+		// declared in the manifest are checked again when installed.
+		if locked && !c.checkLocked(e, locks) {
+			failed++
+			continue
+		} else if e.Original == "" || !originals[e.Original] {
+			if _, ok := c.entrySource(e); !ok {
+				failed++
+				continue
+			}
+		}
+		replace = append(replace, e.Name)
+		install = append(install, e)
+	}
+	if prune {
+		for _, e := range c.manifest().Programs {
+			if declared[e.Name] {
+				continue
+			}
+			if !forcePinned && e.Pinned {
+				fmt.Printf("Skipping %s %s\n", e.Name, brightBlack("(pinned)"))
+				continue
+			}
+			remove = append(remove, e.Name)
+		}
+	}
+	if len(install)+len(remove)+len(pins)+failed == 0 {
+		fmt.Println("Already up to date")
+		return
+	}
+	if dryRun {
+		for _, name := range replace {
+			fmt.Printf("Would replace %s\n", name)
+		}
+		for _, name := range remove {
+			fmt.Printf("Would remove %s\n", name)
+		}
+		for _, e := range install {
+			if !contains(replace, e.Name) {
+				fmt.Printf("Would install %s\n", e.Name)
+			}
+		}
+		for _, e := range pins {
+			if e.Pinned {
+				fmt.Printf("Would pin %s\n", e.Name)
+			} else {
+				fmt.Printf("Would unpin %s\n", e.Name)
+			}
+		}
+		return
+	}
+	removed := 0
+	for _, name := range remove {
+		fmt.Printf("Removing %s\n", name)
+		if err := c.overwrite(filepath.Join(c.bin(), name)); err != nil {
+			c.error("%s: %s", name, err)
+			failed++
+			continue
+		}
+		c.forget(name)
+		removed++
+	}
+	// Install aliases last so that their originals exist.
+	sort.SliceStable(install, func(i, j int) bool {
+		return install[i].Original == "" && install[j].Original != ""
+	})
+	installed, replaced := 0, 0
+	for _, e := range install {
+		replacing := contains(replace, e.Name)
+		if replacing {
+			// Only remove the old program once the new one can be installed.
+			if _, ok := c.entrySource(e); !ok {
+				failed++
+				continue
+			}
+			if err := c.overwrite(filepath.Join(c.bin(), e.Name)); err != nil {
+				c.error("%s: %s", e.Name, err)
+				failed++
+				continue
+			}
+			c.forget(e.Name)
+		}
+		switch c.installEntry(e) {
+		case entryInstalled:
+			if replacing {
+				replaced++
+			} else {
+				installed++
+			}
+		case entryConflict, entryFailed:
+			failed++
+		}
+	}
+	pinned, unpinned := 0, 0
+	for _, e := range pins {
+		if e.Pinned {
+			fmt.Printf("Pinning %s\n", e.Name)
+			pinned++
+		} else {
+			fmt.Printf("Unpinning %s\n", e.Name)
+			unpinned++
+		}
+		c.state().program(e.Name).Pinned = e.Pinned
+		c.modified()
+	}
+	fmt.Printf(
+		"Installed %d, replaced %d, removed %d, pinned %d, unpinned %d, failed %d\n",
+		installed, replaced, removed, pinned, unpinned, failed,
+	)
+}
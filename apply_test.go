@@ -0,0 +1,137 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exportManifest runs sim export and returns the path of the manifest.
+func exportManifest(t *testing.T, home string) string {
+	t.Helper()
+	file := filepath.Join(home, "manifest.json")
+	if !runSim(t, "export", file) {
+		t.Fatal("export failed")
+	}
+	return file
+}
+
+// editManifest rewrites the manifest at file by calling edit on it.
+func editManifest(t *testing.T, file string, edit func(m *manifest)) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	edit(&m)
+	if data, err = json.Marshal(&m); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyInstallsAndPrunes(t *testing.T) {
+	home := testEnv(t)
+	for _, name := range []string{"foo", "bar"} {
+		writeScript(t, filepath.Join(home, "src", name), name)
+		if !runSim(t, "install", filepath.Join(home, "src", name)) {
+			t.Fatal("install failed")
+		}
+	}
+	file := exportManifest(t, home)
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	writeScript(t, filepath.Join(home, "src", "baz"), "baz")
+	if !runSim(t, "install", filepath.Join(home, "src", "baz")) {
+		t.Fatal("install failed")
+	}
+	if !runSim(t, "apply", file) {
+		t.Fatal("apply failed")
+	}
+	if !exists(filepath.Join(home, "bin", "foo")) {
+		t.Error("apply did not install foo")
+	}
+	if !exists(filepath.Join(home, "bin", "baz")) {
+		t.Error("apply without --prune removed baz")
+	}
+	if !runSim(t, "apply", "--prune", file) {
+		t.Fatal("apply --prune failed")
+	}
+	if exists(filepath.Join(home, "bin", "baz")) {
+		t.Error("apply --prune did not remove baz")
+	}
+	if !exists(filepath.Join(home, "bin", "bar")) {
+		t.Error("apply --prune removed bar")
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	home := testEnv(t)
+	writeScript(t, filepath.Join(home, "src", "foo"), "foo")
+	if !runSim(t, "install", filepath.Join(home, "src", "foo")) {
+		t.Fatal("install failed")
+	}
+	file := exportManifest(t, home)
+	editManifest(t, file, func(m *manifest) { m.Programs[0].Pinned = true })
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	if !runSim(t, "apply", "--dry-run", file) {
+		t.Fatal("apply --dry-run failed")
+	}
+	if exists(filepath.Join(home, "bin", "foo")) {
+		t.Error("apply --dry-run installed foo")
+	}
+	if loadState(t).lookup("foo").pinned() {
+		t.Error("apply --dry-run pinned foo")
+	}
+}
+
+func TestApplyPins(t *testing.T) {
+	home := testEnv(t)
+	writeScript(t, filepath.Join(home, "src", "foo"), "foo")
+	if !runSim(t, "install", filepath.Join(home, "src", "foo")) {
+		t.Fatal("install failed")
+	}
+	unpinned := exportManifest(t, home)
+	// An installed program that matches the manifest is pinned if the
+	// manifest says so.
+	pinned := filepath.Join(home, "pinned.json")
+	data, err := os.ReadFile(unpinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pinned, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	editManifest(t, pinned, func(m *manifest) { m.Programs[0].Pinned = true })
+	if !runSim(t, "apply", pinned) {
+		t.Fatal("apply failed")
+	}
+	if !loadState(t).lookup("foo").pinned() {
+		t.Fatal("apply did not pin foo")
+	}
+	// Unpinning requires --force-pinned.
+	if !runSim(t, "apply", unpinned) {
+		t.Fatal("apply failed")
+	}
+	if !loadState(t).lookup("foo").pinned() {
+		t.Error("apply unpinned foo without --force-pinned")
+	}
+	if !runSim(t, "apply", "--force-pinned", unpinned) {
+		t.Fatal("apply --force-pinned failed")
+	}
+	if loadState(t).lookup("foo").pinned() {
+		t.Error("apply --force-pinned did not unpin foo")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// A backup is a gzipped tar archive containing state.json followed by each
+// program under bin/, with symlinks stored as symlinks.
+const (
+	backupStateName = "state.json"
+	backupBinDir    = "bin"
+)
+
+func (c *command) backup(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := "sim-backup-" + time.Now().Format(backupTimeFormat) + ".tar.gz"
+	if len(opts.args) == 1 {
+		file = opts.args[0]
+	}
+	n := c.createArchive(file, force, c.writeBackup)
+	fmt.Printf("Backed up %d programs to %s\n", n, blue(file))
+}
+
+// createArchive creates a .tar.gz file using write, which returns the number
+// of programs it added. On failure, it removes the file and exits.
+func (c *command) createArchive(file string, force bool, write func(*tar.Writer) (int, error)) int {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(file, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		c.fatal("%s: exists (overwrite with --force)", file)
+	} else if err != nil {
+		c.fatal("%s", err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	n, err := write(tw)
+	for _, closer := range []io.Closer{tw, gz, f} {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(file)
+		c.fatal("%s: %s", file, err)
+	}
+	return n
+}
+
+// writeBackup writes the state file and all programs to tw.
+func (c *command) writeBackup(tw *tar.Writer) (int, error) {
+	data, err := json.MarshalIndent(c.state(), "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    backupStateName,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		src := filepath.Join(c.bin(), file.Name())
+		info, err := os.Lstat(src)
+		if err != nil {
+			return n, err
+		}
+		if !isSymlink(info.Mode()) && !info.Mode().IsRegular() {
+			continue
+		}
+		if err := addToArchive(tw, path.Join(backupBinDir, file.Name()), src, info); err != nil {
+			return n, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// addToArchive adds the file at src to tw under the given name. If info is
+// for a symlink, it adds the symlink rather than its target.
+func addToArchive(tw *tar.Writer, name, src string, info fs.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, linkTarget(src))
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func (c *command) bundle(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := "sim-bundle-" + time.Now().Format(backupTimeFormat) + ".tar.gz"
+	if len(opts.args) == 1 {
+		file = opts.args[0]
+	}
+	n := c.createArchive(file, force, c.writeBundle)
+	fmt.Printf("Bundled %d programs into %s\n", n, blue(file))
+}
+
+// writeBundle writes all programs to tw, following symlinks. It reports errors
+// for broken symlinks and skips them.
+func (c *command) writeBundle(tw *tar.Writer) (int, error) {
+	n := 0
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		src := filepath.Join(c.bin(), file.Name())
+		info, err := os.Stat(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			c.error("%s: broken symlink", file.Name())
+			continue
+		} else if err != nil {
+			c.error("%s: %s", file.Name(), err)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err := addToArchive(tw, file.Name(), src, info); err != nil {
+			return n, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (c *command) restore(opts *options) {
+	force := opts.bool('f', "force")
+	dryRun := opts.bool('n', "dry-run")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := opts.args[0]
+	f, err := os.Open(file)
+	if err != nil {
+		c.fatal("%s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		c.fatal("%s: %s", file, err)
+	}
+	tr := tar.NewReader(gz)
+	var saved state
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			c.fatal("%s: %s", file, err)
+		}
+		if header.Name == backupStateName {
+			if err := json.NewDecoder(tr).Decode(&saved); err != nil {
+				c.fatal("%s: %s: %s", file, backupStateName, err)
+			}
+			continue
+		}
+		dir, name := path.Split(header.Name)
+		if path.Clean(dir) != backupBinDir || name == "" || name[0] == '.' {
+			c.error("%s: %s: unexpected file in backup", file, header.Name)
+			continue
+		}
+		c.restoreProgram(tr, header, saved.lookup(name), force, dryRun)
+	}
+}
+
+// restoreProgram restores a program from a backup archive, along with its
+// metadata p. If the program is already the same as in the backup, it only
+// restores the metadata.
+func (c *command) restoreProgram(r io.Reader, header *tar.Header, p *programState, force, dryRun bool) {
+	name := path.Base(header.Name)
+	dest := filepath.Join(c.bin(), name)
+	var content []byte
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		if linkTarget(dest) == header.Linkname {
+			c.restoreMetadata(name, p, dryRun)
+			return
+		}
+	case tar.TypeReg:
+		var err error
+		if content, err = io.ReadAll(r); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+		if existing, err := os.ReadFile(dest); err == nil && linkTarget(dest) == "" && bytes.Equal(existing, content) {
+			c.restoreMetadata(name, p, dryRun)
+			return
+		}
+	default:
+		c.error("%s: unsupported file type in backup", name)
+		return
+	}
+	if _, err := os.Lstat(dest); err == nil && !force {
+		c.error("%s: exists (overwrite with --force)", name)
+		return
+	}
+	verb := "Restoring"
+	if dryRun {
+		verb = "Would restore"
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		fmt.Printf("%s %s %s %s\n", verb, name, brightBlack("->"), blue(header.Linkname))
+	} else {
+		fmt.Printf("%s %s\n", verb, name)
+	}
+	if dryRun {
+		return
+	}
+	if err := c.overwrite(dest); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	var err error
+	if header.Typeflag == tar.TypeSymlink {
+		err = os.Symlink(header.Linkname, dest)
+	} else if err = os.WriteFile(dest, content, 0o644); err == nil {
+		err = os.Chmod(dest, header.FileInfo().Mode().Perm())
+	}
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	target := ""
+	if header.Typeflag == tar.TypeSymlink {
+		target = filepath.Clean(ensureAbs(c.bin(), header.Linkname))
+	}
+	c.logChange("restore", dest, target)
+	c.restoreMetadata(name, p, false)
+}
+
+// restoreMetadata replaces a program's metadata with p, or forgets it if p is
+// nil.
+func (c *command) restoreMetadata(name string, p *programState, dryRun bool) {
+	if dryRun {
+		return
+	}
+	if p == nil {
+		c.forget(name)
+		return
+	}
+	*c.state().program(name) = *p
+	c.modified()
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errBatchAbort is used to end a line of sim batch after a fatal error.
+var errBatchAbort = errors.New("batch line aborted")
+
+// batchUnsupported lists commands that cannot run in sim batch.
+var batchUnsupported = map[string]bool{
+	"batch": true,
+	// These replace the process or run forever.
+	"exec": true, "watch": true,
+}
+
+func (c *command) runBatch(opts *options) {
+	errExit := opts.bool('e', "errexit")
+	verbose := opts.bool('v', "verbose")
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	// Read everything up front so that prompts do not consume commands.
+	var data []byte
+	var err error
+	if len(opts.args) == 0 || opts.args[0] == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(opts.args[0])
+	}
+	if err != nil {
+		c.fatal("%s", err)
+	}
+	ran, failed := 0, 0
+	for i, line := range strings.Split(string(data), "\n") {
+		words, err := splitWords(line, c.home())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "batch: line %d: %s\n", i+1, err)
+			failed++
+		} else if len(words) == 0 {
+			continue
+		} else {
+			if verbose {
+				fmt.Println(brightBlack("$ sim " + shellJoin(words)))
+			}
+			ran++
+			if !c.runLine(words) {
+				fmt.Fprintf(os.Stderr, "batch: line %d failed: %s\n", i+1, shellJoin(words))
+				failed++
+			}
+		}
+		if failed > 0 && errExit {
+			break
+		}
+	}
+	c.name = "batch"
+	c.failed = failed > 0
+	c.exitCode = 0
+	fmt.Printf("Ran %d, failed %d\n", ran, failed)
+}
+
+// runLine runs a single line of sim batch, sharing state with the rest of the
+// batch. It returns false if the command failed.
+func (c *command) runLine(words []string) (ok bool) {
+	c.args = words
+	c.failed = false
+	c.exitCode = 0
+	c.undid = nil
+	c.undoFailed = nil
+	c.batch = true
+	defer func() {
+		c.batch = false
+		if r := recover(); r != nil && r != errBatchAbort {
+			panic(r)
+		}
+		// Each line gets its own journal entry so it can be undone.
+		c.saveJournal()
+		ok = !c.failed
+	}()
+	c.run(parseOptions(words))
+	return
+}
+
+// splitWords splits a line into words like a POSIX shell. It supports single
+// quotes, double quotes, backslash escapes, comments starting with '#', and a
+// leading unquoted "~" for the home directory, but no other expansions.
+func splitWords(line, home string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '#' && !inWord:
+			return words, nil
+		case ch == '~' && !inWord && (i+1 == len(line) || strings.IndexByte("/ \t\r", line[i+1]) >= 0):
+			inWord = true
+			word.WriteString(home)
+		case ch == '\\':
+			if i+1 == len(line) {
+				return nil, errors.New("trailing backslash")
+			}
+			inWord = true
+			i++
+			word.WriteByte(line[i])
+		case ch == '\'':
+			inWord = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		case ch == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i == len(line) {
+					return nil, errors.New("unterminated double quote")
+				}
+				if line[i] == '"' {
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\\\"$`", line[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+		default:
+			inWord = true
+			word.WriteByte(ch)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   \t\r", nil},
+		{"install foo", []string{"install", "foo"}},
+		{"  install \t foo  ", []string{"install", "foo"}},
+		{"# comment", nil},
+		{"rm foo # comment", []string{"rm", "foo"}},
+		{"rm foo#bar", []string{"rm", "foo#bar"}},
+		{"rm 'foo # bar'", []string{"rm", "foo # bar"}},
+		{"rm 'foo bar'", []string{"rm", "foo bar"}},
+		{"rm ''", []string{"rm", ""}},
+		{`rm ""`, []string{"rm", ""}},
+		{`rm a'b'"c"d`, []string{"rm", "abcd"}},
+		{`rm 'a\b'`, []string{"rm", `a\b`}},
+		{`rm "a\"b"`, []string{"rm", `a"b`}},
+		{`rm "a\\b"`, []string{"rm", `a\b`}},
+		{`rm "a\b"`, []string{"rm", `a\b`}},
+		{`rm "a\$b"`, []string{"rm", "a$b"}},
+		{`rm "it's"`, []string{"rm", "it's"}},
+		{`rm a\ b`, []string{"rm", "a b"}},
+		{`rm a\#b \#c`, []string{"rm", "a#b", "#c"}},
+		{"ls ~", []string{"ls", "/home/me"}},
+		{"ls ~/bin", []string{"ls", "/home/me/bin"}},
+		{"ls ~user", []string{"ls", "~user"}},
+		{"ls a~", []string{"ls", "a~"}},
+		{"ls '~'", []string{"ls", "~"}},
+		{`ls \~`, []string{"ls", "~"}},
+	} {
+		got, err := splitWords(tc.line, "/home/me")
+		if err != nil {
+			t.Errorf("splitWords(%q): unexpected error: %s", tc.line, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestSplitWordsErrors(t *testing.T) {
+	for _, line := range []string{
+		"rm 'foo",
+		`rm "foo`,
+		`rm "foo\"`,
+		`rm 'a' "b`,
+		`rm foo\`,
+		`\`,
+	} {
+		if got, err := splitWords(line, "/home/me"); err == nil {
+			t.Errorf("splitWords(%q) = %q, want error", line, got)
+		}
+	}
+}
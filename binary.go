@@ -0,0 +1,284 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// binaryInfo describes the platforms an executable was built for.
+type binaryInfo struct {
+	// Executable format: "elf" or "macho".
+	format string
+	// Architectures in GOARCH form, or a description if unrecognized. Mach-O
+	// universal binaries can have more than one.
+	archs []string
+}
+
+// readBinaryInfo parses the ELF or Mach-O header of the file at path.
+func readBinaryInfo(path string) (binaryInfo, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return binaryInfo{format: "elf", archs: []string{elfArch(f)}}, nil
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return binaryInfo{format: "macho", archs: []string{machoArch(f.Cpu)}}, nil
+	}
+	if f, err := macho.OpenFat(path); err == nil {
+		defer f.Close()
+		info := binaryInfo{format: "macho"}
+		for _, arch := range f.Arches {
+			info.archs = append(info.archs, machoArch(arch.Cpu))
+		}
+		return info, nil
+	}
+	return binaryInfo{}, errors.New("not an ELF or Mach-O binary")
+}
+
+func elfArch(f *elf.File) string {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_PPC64:
+		if f.ByteOrder == binary.LittleEndian {
+			return "ppc64le"
+		}
+		return "ppc64"
+	}
+	return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+}
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+// hostFormat is the executable format used by the host OS.
+var hostFormat = func() string {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return "macho"
+	}
+	return "elf"
+}()
+
+// rosettaPath is present on Apple silicon Macs with Rosetta 2 installed.
+const rosettaPath = "/Library/Apple/usr/share/rosetta/rosetta"
+
+// runsOnHost returns nil if the binary can run on this machine, and otherwise
+// an error describing the mismatch.
+func (b binaryInfo) runsOnHost() error {
+	if b.format != hostFormat {
+		return fmt.Errorf("%s binary cannot run on %s", formatName(b.format), runtime.GOOS)
+	}
+	for _, arch := range b.archs {
+		if arch == runtime.GOARCH {
+			return nil
+		}
+		if arch == "386" && runtime.GOARCH == "amd64" && runtime.GOOS != "darwin" {
+			return nil
+		}
+		if arch == "amd64" && runtime.GOARCH == "arm64" && runtime.GOOS == "darwin" {
+			if _, err := os.Stat(rosettaPath); err == nil {
+				return nil
+			}
+			return errors.New("amd64 binary needs Rosetta, which is not installed")
+		}
+	}
+	return fmt.Errorf("built for %s, but host is %s", strings.Join(b.archs, "+"), runtime.GOARCH)
+}
+
+func formatName(format string) string {
+	if format == "macho" {
+		return "Mach-O"
+	}
+	return "ELF"
+}
+
+// checkTruncated returns an error if the headers of the ELF or Mach-O binary
+// at path refer to data past the end of the file, as happens when a copy is
+// interrupted. It only reads headers, so it works even when debug/elf and
+// debug/macho would fail to parse the file.
+func checkTruncated(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	required, err := requiredSize(f, size)
+	if err != nil {
+		return err
+	}
+	if required > size {
+		return fmt.Errorf("truncated binary: headers need %d bytes, but file has %d", required, size)
+	}
+	return nil
+}
+
+// errShortHeader is returned when a file is too short to contain its headers.
+var errShortHeader = errors.New("truncated binary: incomplete header")
+
+// requiredSize returns the minimum file size implied by the headers of the
+// binary in r, which has the given size.
+func requiredSize(r io.ReaderAt, size int64) (int64, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return 0, errShortHeader
+	}
+	switch {
+	case string(magic) == "\x7fELF":
+		return elfRequiredSize(r)
+	case binary.BigEndian.Uint32(magic) == 0xcafebabe:
+		return fatRequiredSize(r)
+	}
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(magic) {
+		case 0xfeedface:
+			return machoRequiredSize(r, size, order, 28, false)
+		case 0xfeedfacf:
+			return machoRequiredSize(r, size, order, 32, true)
+		}
+	}
+	return 0, errors.New("not an ELF or Mach-O binary")
+}
+
+func elfRequiredSize(r io.ReaderAt) (int64, error) {
+	hdr := make([]byte, 64)
+	if _, err := r.ReadAt(hdr[:52], 0); err != nil {
+		return 0, errShortHeader
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(hdr[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	// Offsets of fields in the file header and program headers.
+	var phoff, shoff, phentsize, phnum, shentsize, shnum int64
+	var offField, fileszField func(ph []byte) int64
+	switch elf.Class(hdr[elf.EI_CLASS]) {
+	case elf.ELFCLASS32:
+		phoff = int64(order.Uint32(hdr[28:]))
+		shoff = int64(order.Uint32(hdr[32:]))
+		phentsize, phnum = int64(order.Uint16(hdr[42:])), int64(order.Uint16(hdr[44:]))
+		shentsize, shnum = int64(order.Uint16(hdr[46:])), int64(order.Uint16(hdr[48:]))
+		offField = func(ph []byte) int64 { return int64(order.Uint32(ph[4:])) }
+		fileszField = func(ph []byte) int64 { return int64(order.Uint32(ph[16:])) }
+	case elf.ELFCLASS64:
+		if _, err := r.ReadAt(hdr, 0); err != nil {
+			return 0, errShortHeader
+		}
+		phoff = int64(order.Uint64(hdr[32:]))
+		shoff = int64(order.Uint64(hdr[40:]))
+		phentsize, phnum = int64(order.Uint16(hdr[54:])), int64(order.Uint16(hdr[56:]))
+		shentsize, shnum = int64(order.Uint16(hdr[58:])), int64(order.Uint16(hdr[60:]))
+		offField = func(ph []byte) int64 { return int64(order.Uint64(ph[8:])) }
+		fileszField = func(ph []byte) int64 { return int64(order.Uint64(ph[32:])) }
+	default:
+		return 0, errors.New("unknown ELF class")
+	}
+	required := phoff + phentsize*phnum
+	if shnum > 0 && shoff+shentsize*shnum > required {
+		required = shoff + shentsize*shnum
+	}
+	if phentsize < 40 {
+		return required, nil
+	}
+	ph := make([]byte, phentsize)
+	for i := int64(0); i < phnum; i++ {
+		if _, err := r.ReadAt(ph, phoff+i*phentsize); err != nil {
+			break
+		}
+		if end := offField(ph) + fileszField(ph); end > required {
+			required = end
+		}
+	}
+	return required, nil
+}
+
+func machoRequiredSize(r io.ReaderAt, size int64, order binary.ByteOrder, hdrSize int64, is64 bool) (int64, error) {
+	hdr := make([]byte, hdrSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return 0, errShortHeader
+	}
+	ncmds := int64(order.Uint32(hdr[16:]))
+	sizeofcmds := int64(order.Uint32(hdr[20:]))
+	required := hdrSize + sizeofcmds
+	if required > size {
+		return required, nil
+	}
+	cmds := make([]byte, sizeofcmds)
+	// Check n rather than err, since reading no commands at the end is io.EOF.
+	if n, err := r.ReadAt(cmds, hdrSize); n < len(cmds) {
+		return 0, err
+	}
+	for i := int64(0); i < ncmds && len(cmds) >= 8; i++ {
+		cmd, cmdsize := macho.LoadCmd(order.Uint32(cmds)), order.Uint32(cmds[4:])
+		if cmdsize < 8 || int(cmdsize) > len(cmds) {
+			break
+		}
+		var end int64
+		if cmd == macho.LoadCmdSegment64 && is64 && cmdsize >= 56 {
+			end = int64(order.Uint64(cmds[40:]) + order.Uint64(cmds[48:]))
+		} else if cmd == macho.LoadCmdSegment && cmdsize >= 40 {
+			end = int64(order.Uint32(cmds[32:]) + order.Uint32(cmds[36:]))
+		}
+		if end > required {
+			required = end
+		}
+		cmds = cmds[cmdsize:]
+	}
+	return required, nil
+}
+
+func fatRequiredSize(r io.ReaderAt) (int64, error) {
+	hdr := make([]byte, 8)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return 0, errShortHeader
+	}
+	narch := int64(binary.BigEndian.Uint32(hdr[4:]))
+	required := 8 + 20*narch
+	arch := make([]byte, 20)
+	for i := int64(0); i < narch; i++ {
+		if _, err := r.ReadAt(arch, 8+20*i); err != nil {
+			break
+		}
+		offset := int64(binary.BigEndian.Uint32(arch[8:]))
+		if end := offset + int64(binary.BigEndian.Uint32(arch[12:])); end > required {
+			required = end
+		}
+	}
+	return required, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// elfHeader returns an ELF file header with the given fields.
+func elfHeader(class, data byte, order binary.ByteOrder, phoff, shoff uint64, phentsize, phnum, shentsize, shnum uint16) []byte {
+	if class == 1 {
+		hdr := make([]byte, 52)
+		copy(hdr, "\x7fELF")
+		hdr[4], hdr[5] = class, data
+		order.PutUint32(hdr[28:], uint32(phoff))
+		order.PutUint32(hdr[32:], uint32(shoff))
+		order.PutUint16(hdr[42:], phentsize)
+		order.PutUint16(hdr[44:], phnum)
+		order.PutUint16(hdr[46:], shentsize)
+		order.PutUint16(hdr[48:], shnum)
+		return hdr
+	}
+	hdr := make([]byte, 64)
+	copy(hdr, "\x7fELF")
+	hdr[4], hdr[5] = class, data
+	order.PutUint64(hdr[32:], phoff)
+	order.PutUint64(hdr[40:], shoff)
+	order.PutUint16(hdr[54:], phentsize)
+	order.PutUint16(hdr[56:], phnum)
+	order.PutUint16(hdr[58:], shentsize)
+	order.PutUint16(hdr[60:], shnum)
+	return hdr
+}
+
+// elf64 returns a little-endian 64-bit ELF file with one program header for a
+// segment at offset with length filesz.
+func elf64(offset, filesz uint64) []byte {
+	order := binary.LittleEndian
+	ph := make([]byte, 56)
+	order.PutUint64(ph[8:], offset)
+	order.PutUint64(ph[32:], filesz)
+	return append(elfHeader(2, 1, order, 64, 0, 56, 1, 0, 0), ph...)
+}
+
+// elf32 returns a big-endian 32-bit ELF file with one program header for a
+// segment at offset with length filesz.
+func elf32(offset, filesz uint32) []byte {
+	order := binary.BigEndian
+	ph := make([]byte, 40)
+	order.PutUint32(ph[4:], offset)
+	order.PutUint32(ph[16:], filesz)
+	return append(elfHeader(1, 2, order, 52, 0, 40, 1, 0, 0), ph...)
+}
+
+// macho64 returns a little-endian 64-bit Mach-O file with a segment command for
+// each (fileoff, filesz) pair.
+func macho64(segments ...[2]uint64) []byte {
+	order := binary.LittleEndian
+	var cmds []byte
+	for _, seg := range segments {
+		cmd := make([]byte, 72)
+		order.PutUint32(cmd, 0x19) // LC_SEGMENT_64
+		order.PutUint32(cmd[4:], 72)
+		order.PutUint64(cmd[40:], seg[0])
+		order.PutUint64(cmd[48:], seg[1])
+		cmds = append(cmds, cmd...)
+	}
+	hdr := make([]byte, 32)
+	order.PutUint32(hdr, 0xfeedfacf)
+	order.PutUint32(hdr[16:], uint32(len(segments)))
+	order.PutUint32(hdr[20:], uint32(len(cmds)))
+	return append(hdr, cmds...)
+}
+
+// macho32 returns a big-endian 32-bit Mach-O file with one segment at fileoff
+// with length filesz.
+func macho32(fileoff, filesz uint32) []byte {
+	order := binary.BigEndian
+	cmd := make([]byte, 56)
+	order.PutUint32(cmd, 0x1) // LC_SEGMENT
+	order.PutUint32(cmd[4:], 56)
+	order.PutUint32(cmd[32:], fileoff)
+	order.PutUint32(cmd[36:], filesz)
+	hdr := make([]byte, 28)
+	order.PutUint32(hdr, 0xfeedface)
+	order.PutUint32(hdr[16:], 1)
+	order.PutUint32(hdr[20:], uint32(len(cmd)))
+	return append(hdr, cmd...)
+}
+
+// fat returns a Mach-O universal binary header with the given (offset, size)
+// pairs for each architecture. The header claims narch architectures.
+func fat(narch uint32, arches ...[2]uint32) []byte {
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, 0xcafebabe)
+	binary.BigEndian.PutUint32(hdr[4:], narch)
+	for _, arch := range arches {
+		entry := make([]byte, 20)
+		binary.BigEndian.PutUint32(entry[8:], arch[0])
+		binary.BigEndian.PutUint32(entry[12:], arch[1])
+		hdr = append(hdr, entry...)
+	}
+	return hdr
+}
+
+// withCommand replaces the load commands of a Mach-O file from macho64 with a
+// single command of kind cmd and size cmdsize.
+func withCommand(file []byte, cmd, cmdsize uint32) []byte {
+	file = append([]byte{}, file...)
+	binary.LittleEndian.PutUint32(file[32:], cmd)
+	binary.LittleEndian.PutUint32(file[36:], cmdsize)
+	return file
+}
+
+func TestRequiredSize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want int64
+	}{
+		{"elf64 segment", elf64(0, 500), 500},
+		{"elf64 headers only", elf64(0, 0), 120},
+		{"elf64 section headers", elfHeader(2, 1, binary.LittleEndian, 64, 1000, 56, 0, 64, 3), 1192},
+		{"elf64 corrupt program header offset", elfHeader(2, 1, binary.LittleEndian, 1<<40, 0, 56, 2, 0, 0), 1<<40 + 112},
+		{"elf64 program headers past end", elfHeader(2, 1, binary.LittleEndian, 64, 0, 56, 4, 0, 0), 288},
+		{"elf32 big-endian segment", elf32(100, 300), 400},
+		{"elf32 small program header size", elfHeader(1, 1, binary.LittleEndian, 52, 0, 8, 3, 0, 0), 76},
+		{"macho64 segment", macho64([2]uint64{0, 4096}), 4096},
+		{"macho64 largest segment", macho64([2]uint64{0, 4096}, [2]uint64{8192, 100}, [2]uint64{4096, 10}), 8292},
+		{"macho64 no commands", macho64(), 32},
+		{"macho64 zero cmdsize", withCommand(macho64([2]uint64{0, 4096}), 0x19, 0), 104},
+		{"macho64 oversized cmdsize", withCommand(macho64([2]uint64{0, 4096}), 0x19, 1000), 104},
+		{"macho64 other command", withCommand(macho64([2]uint64{0, 4096}), 0x2, 72), 104},
+		{"macho64 commands past end", macho64([2]uint64{0, 4096})[:40], 104},
+		{"macho32 big-endian segment", macho32(4096, 4096), 8192},
+		{"fat", fat(2, [2]uint32{4096, 1000}, [2]uint32{8192, 500}), 8692},
+		{"fat no arches", fat(0), 8},
+		{"fat arches past end", fat(1000, [2]uint32{4096, 100}), 20008},
+	} {
+		got, err := requiredSize(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequiredSizeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		short bool
+	}{
+		{"empty", nil, true},
+		{"short magic", []byte("\x7fEL"), true},
+		{"script", []byte("#!/bin/sh\necho hi\n"), false},
+		{"elf magic only", []byte("\x7fELF"), true},
+		{"elf32 truncated header", elfHeader(1, 1, binary.LittleEndian, 52, 0, 32, 1, 0, 0)[:40], true},
+		{"elf64 truncated header", elfHeader(2, 1, binary.LittleEndian, 64, 0, 56, 1, 0, 0)[:56], true},
+		{"elf unknown class", elfHeader(3, 1, binary.LittleEndian, 0, 0, 0, 0, 0, 0), false},
+		{"macho64 truncated header", macho64()[:20], true},
+		{"macho32 magic only", macho32(0, 0)[:4], true},
+		{"fat magic only", fat(1)[:4], true},
+	} {
+		_, err := requiredSize(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		} else if tc.short != errors.Is(err, errShortHeader) {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		}
+	}
+}
+
+func TestRequiredSizeOwnExecutable(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Skip(err)
+	}
+	required, err := requiredSize(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("%s: %s", exe, err)
+	}
+	if required > int64(len(data)) {
+		t.Errorf("%s: headers need %d bytes, but file has %d", exe, required, len(data))
+	}
+	half := data[:len(data)/2]
+	required, err = requiredSize(bytes.NewReader(half), int64(len(half)))
+	if err != nil {
+		t.Fatalf("%s: truncated: %s", exe, err)
+	}
+	if required <= int64(len(half)) {
+		t.Errorf("%s: truncated to %d bytes, but headers only need %d", exe, len(half), required)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes for check.
+const (
+	exitNotInstalled = 1
+	exitUnhealthy    = 2
+)
+
+func (c *command) check(opts *options) {
+	verbose := opts.bool('v', "verbose")
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		problem, code := c.checkHealth(name)
+		if code == 0 {
+			continue
+		}
+		if verbose {
+			c.error("%s: %s", name, problem)
+		} else {
+			c.failed = true
+		}
+		if c.exitCode == 0 {
+			c.exitCode = code
+		}
+	}
+}
+
+// checkHealth checks that a program is installed and can be run. If not, it
+// returns a description of the problem and the exit code for sim check.
+func (c *command) checkHealth(name string) (string, int) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return "invalid program name", exitNotInstalled
+	}
+	path := filepath.Join(c.bin(), name)
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return "not installed", exitNotInstalled
+	} else if err != nil {
+		return err.Error(), exitUnhealthy
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "broken symlink", exitUnhealthy
+	} else if err != nil {
+		return err.Error(), exitUnhealthy
+	} else if info.IsDir() {
+		return "is a directory", exitUnhealthy
+	} else if !isExecutable(info.Mode()) {
+		return "not an executable", exitUnhealthy
+	} else if !canExecute(path) {
+		return "not executable by current user", exitUnhealthy
+	}
+	if p := c.state().lookup(name); p != nil && p.Mode == modeShim && len(p.Command) != 0 {
+		if _, err := exec.LookPath(p.Command[0]); err != nil {
+			return fmt.Sprintf("shim command not found: %s", p.Command[0]), exitUnhealthy
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Commands whose arguments are names of installed programs.
+var programArgCommands = map[string]bool{
+	"remove": true, "list": true, "update": true, "outdated": true,
+	"diff": true, "freeze": true, "thaw": true, "rename": true, "alias": true,
+	"which": true, "info": true, "exec": true, "edit": true, "cat": true,
+	"open": true, "target": true, "adopt": true, "grep": true, "log": true,
+	"pin": true, "unpin": true, "disable": true, "watch": true,
+	"verify": true, "rollback": true, "shadow": true, "check": true, "repair": true,
+}
+
+// complete prints completion candidates for a partial command line, one per
+// line. The arguments are the words after "sim", ending with the word being
+// completed. Generated completion scripts call it as "sim __complete -- ...",
+// and fall back to completing files when it prints nothing.
+func (c *command) complete(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	words := opts.args
+	cur := words[len(words)-1]
+	if len(words) == 1 {
+		for _, spec := range commandSpecs() {
+			printCandidates(commandNames(spec), cur)
+		}
+		return
+	}
+	name := canonicalCommand(words[0])
+	if name == "" {
+		return
+	}
+	endOfFlags := false
+	for _, word := range words[1 : len(words)-1] {
+		if word == "--" {
+			endOfFlags = true
+		}
+	}
+	if !endOfFlags && strings.HasPrefix(cur, "-") {
+		printCandidates(flagNames(name), cur)
+		return
+	}
+	if prev := words[len(words)-2]; !endOfFlags && takesArgument(name, prev) {
+		return
+	}
+	switch {
+	case name == "help":
+		if len(words) == 2 {
+			for _, spec := range commandSpecs() {
+				printCandidates(commandNames(spec), cur)
+			}
+		}
+	case name == "completion" || name == "init":
+		printCandidates([]string{"bash", "zsh", "fish"}, cur)
+	case name == "sources":
+		if len(words) == 2 {
+			printCandidates([]string{"list", "add", "remove"}, cur)
+		} else if words[1] == "remove" || words[1] == "rm" {
+			printCandidates(c.configuredSources(), cur)
+		}
+	case name == "enable":
+		printCandidates(programNames(c.disabledDir()), cur)
+	case name == "switch":
+		if len(words) == 2 {
+			printCandidates(programNames(c.bin()), cur)
+		} else if len(words) == 3 {
+			printCandidates(c.versions(words[1]), cur)
+		}
+	case programArgCommands[name]:
+		// Rename and alias only take an existing program first.
+		if (name == "rename" || name == "alias") && len(words) > 2 {
+			return
+		}
+		printCandidates(programNames(c.bin()), cur)
+	}
+}
+
+// canonicalCommand returns the full name of a command given it or one of its
+// aliases, or "" if there is no such command.
+func canonicalCommand(name string) string {
+	for _, spec := range commandSpecs() {
+		for _, n := range commandNames(spec) {
+			if n == name {
+				return spec.Name
+			}
+		}
+	}
+	return ""
+}
+
+// takesArgument returns true if word is a flag of the command that expects an
+// argument after it.
+func takesArgument(command, word string) bool {
+	for _, flag := range flagSpecs(command) {
+		if flag.Arg != "" && (word == "-"+flag.Short && flag.Short != "" || word == "--"+flag.Long) {
+			return true
+		}
+	}
+	return false
+}
+
+// programNames returns the names of programs in dir in natural order, ignoring
+// errors since completion should never be noisy.
+func programNames(dir string) []string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, file := range files {
+		if !skip(file) {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return naturalLess(names[i], names[j])
+	})
+	return names
+}
+
+// printCandidates prints the candidates that start with prefix.
+func printCandidates(candidates []string, prefix string) {
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			fmt.Println(candidate)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (c *command) completion(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	switch shell := opts.args[0]; shell {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		c.fatal("%s: %s: unsupported shell (expected bash, zsh, or fish)", c.name, shell)
+	}
+}
+
+// flagNames returns the flags for a command in the form they are typed.
+func flagNames(name string) []string {
+	var names []string
+	for _, flag := range flagSpecs(name) {
+		if flag.Short != "" {
+			names = append(names, "-"+flag.Short)
+		}
+		names = append(names, "--"+flag.Long)
+	}
+	return names
+}
+
+// commandNames returns the name and aliases of a command.
+func commandNames(spec commandSpec) []string {
+	return append([]string{spec.Name}, spec.Aliases...)
+}
+
+func bashCompletion() string {
+	return `# bash completion for sim
+
+_sim() {
+    local IFS=$'\n'
+    COMPREPLY=($(sim __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+
+complete -o default -F _sim sim
+`
+}
+
+// zshQuote quotes s for use in a single-quoted _arguments or _describe spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef sim\n\n")
+	b.WriteString("_sim_dynamic() {\n")
+	b.WriteString("    local -a candidates\n")
+	b.WriteString("    candidates=(${(f)\"$(sim __complete -- \"${(@)words[1,CURRENT]}\" 2>/dev/null)\"})\n")
+	b.WriteString("    if (( $#candidates )); then\n")
+	b.WriteString("        compadd -a candidates\n")
+	b.WriteString("    else\n")
+	b.WriteString("        _files\n")
+	b.WriteString("    fi\n")
+	b.WriteString("}\n\n")
+	b.WriteString("_sim() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, spec := range commandSpecs() {
+		fmt.Fprintf(&b, "        '%s:%s'\n", spec.Name, zshQuote(spec.Summary))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        _describe command commands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    shift words\n")
+	b.WriteString("    (( CURRENT-- ))\n")
+	b.WriteString("    case $words[1] in\n")
+	for _, spec := range commandSpecs() {
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(commandNames(spec), "|"))
+		b.WriteString("            _arguments -s")
+		for _, flag := range flagSpecs(spec.Name) {
+			arg := ""
+			if flag.Arg != "" {
+				arg = ":" + strings.ToLower(flag.Arg) + ":"
+				if flag.Arg == "DIR" {
+					arg += "_files -/"
+				} else if flag.Arg == "FILE" {
+					arg += "_files"
+				}
+			}
+			desc := "[" + zshQuote(flag.Description) + "]"
+			if flag.Short != "" {
+				fmt.Fprintf(&b, " \\\n                '-%s%s%s'", flag.Short, desc, arg)
+			}
+			fmt.Fprintf(&b, " \\\n                '--%s%s%s'", flag.Long, desc, arg)
+		}
+		b.WriteString(" \\\n                '*:argument:_sim_dynamic' ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n")
+	b.WriteString("    _sim \"$@\"\n")
+	b.WriteString("else\n")
+	b.WriteString("    compdef _sim sim\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for sim\n\n")
+	b.WriteString("complete -c sim -e\n")
+	for _, spec := range commandSpecs() {
+		fmt.Fprintf(&b, "complete -c sim -f -n __fish_use_subcommand -a %s -d %s\n", spec.Name, fishQuote(spec.Summary))
+	}
+	b.WriteString("complete -c sim -n 'not __fish_use_subcommand; and not string match -q -- \"-*\" (commandline -ct)' -a '(sim __complete -- (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'\n")
+	for _, spec := range commandSpecs() {
+		condition := fishQuote("__fish_seen_subcommand_from " + strings.Join(commandNames(spec), " "))
+		for _, flag := range flagSpecs(spec.Name) {
+			fmt.Fprintf(&b, "complete -c sim -n %s", condition)
+			if flag.Short != "" {
+				fmt.Fprintf(&b, " -s %s", flag.Short)
+			}
+			fmt.Fprintf(&b, " -l %s", flag.Long)
+			if flag.Arg != "" {
+				b.WriteString(" -r")
+			}
+			fmt.Fprintf(&b, " -d %s\n", fishQuote(flag.Description))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,11 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+
+package main
+
+// isCrossDevice returns false since there is no portable error for renaming a
+// file to another device. Such moves fail instead of falling back to copying.
+func isCrossDevice(err error) bool {
+	return false
+}
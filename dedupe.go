@@ -0,0 +1,169 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (c *command) dedupe(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	yes := opts.bool('y', "yes")
+	remove := opts.bool('r', "remove")
+	forcePinned := opts.bool(0, "force-pinned")
+	c.validate(opts, noArgs)
+	// Group programs by the checksum of the file they resolve to.
+	groups := make(map[string][]string)
+	var keys []string
+	sums := make(map[string]string)
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(filepath.Join(c.bin(), file.Name()))
+		if err != nil {
+			continue
+		}
+		sum, ok := sums[resolved]
+		if !ok {
+			if sum, err = checksum(resolved); err != nil {
+				c.error("%s: %s", file.Name(), err)
+				continue
+			}
+			sums[resolved] = sum
+		}
+		if _, ok := groups[sum]; !ok {
+			keys = append(keys, sum)
+		}
+		groups[sum] = append(groups[sum], file.Name())
+	}
+	var reclaimed int64
+	for _, key := range keys {
+		reclaimed += c.dedupeGroup(groups[key], dryRun, yes, remove, forcePinned)
+	}
+	if reclaimed > 0 {
+		fmt.Printf("Reclaimed %s\n", formatSize(reclaimed))
+	}
+}
+
+// dedupeGroup consolidates programs with identical content into one, turning
+// the rest into aliases of it or removing them. It returns the number of bytes
+// freed by replacing copies.
+func (c *command) dedupeGroup(names []string, dryRun, yes, remove, forcePinned bool) int64 {
+	// Programs that are already aliases don't need consolidating.
+	var originals []string
+	for _, name := range names {
+		if c.state().lookup(name).original() == "" {
+			originals = append(originals, name)
+		}
+	}
+	if len(originals) < 2 {
+		return 0
+	}
+	// Prefer keeping a pinned program, and otherwise a symlink, since copies
+	// take up space.
+	keep, best := 0, 0
+	for i, name := range originals {
+		score := 0
+		if c.state().lookup(name).pinned() {
+			score = 2
+		} else if info, err := os.Lstat(filepath.Join(c.bin(), name)); err == nil && isSymlink(info.Mode()) {
+			score = 1
+		}
+		if score > best {
+			keep, best = i, score
+		}
+	}
+	fmt.Println("Identical programs:")
+	for i, name := range originals {
+		desc := name
+		path := filepath.Join(c.bin(), name)
+		if target, err := os.Readlink(path); err == nil {
+			desc += fmt.Sprintf(" %s %s", brightBlack("->"), blue(ensureAbs(c.bin(), target)))
+		} else if info, err := os.Stat(path); err == nil {
+			desc += " " + brightBlack(fmt.Sprintf("(file, %s)", formatSize(info.Size())))
+		}
+		if c.state().lookup(name).pinned() {
+			desc += " " + brightBlack("(pinned)")
+		}
+		fmt.Printf("    %d) %s\n", i+1, desc)
+	}
+	if dryRun {
+		fmt.Printf("Would keep %s\n", originals[keep])
+		return 0
+	}
+	if !yes {
+		var ok bool
+		if keep, ok = choose("Keep", len(originals), keep); !ok {
+			return 0
+		}
+	}
+	original, target, ok := c.aliasTarget(originals[keep])
+	if !ok {
+		return 0
+	}
+	var reclaimed int64
+	for _, name := range originals {
+		if name == original {
+			continue
+		}
+		if !forcePinned && c.state().lookup(name).pinned() {
+			fmt.Printf("Skipping %s %s\n", name, brightBlack("(pinned)"))
+			continue
+		}
+		path := filepath.Join(c.bin(), name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		if remove {
+			fmt.Printf("Removing %s\n", name)
+			err = c.overwrite(path)
+		} else {
+			fmt.Printf("Aliasing %s %s %s\n", name, brightBlack("->"), original)
+			err = replaceSymlink(target, path)
+		}
+		if err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		if remove {
+			c.forget(name)
+		} else {
+			c.logChange("alias", path, target)
+			c.recordAlias(name, original)
+		}
+		if info.Mode().IsRegular() {
+			reclaimed += info.Size()
+		}
+	}
+	return reclaimed
+}
+
+// choose asks which of n numbered choices to use, prompting with verb (e.g.
+// "Keep"). It returns a 0-based index, or false if the user chooses to skip.
+func choose(verb string, n, def int) (int, bool) {
+	for {
+		fmt.Printf("%s which? [1-%d, s to skip] (%d) ", verb, n, def+1)
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return 0, false
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			return def, true
+		}
+		if line == "s" || line == "skip" {
+			return 0, false
+		}
+		if i, err := strconv.Atoi(line); err == nil && i >= 1 && i <= n {
+			return i - 1, true
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// disabledName is the directory in $XDG_BIN_HOME where sim disable moves
+// programs. Since it starts with '.', everything else ignores it.
+const disabledName = ".disabled"
+
+func (c *command) disabledDir() string {
+	return filepath.Join(c.bin(), disabledName)
+}
+
+// isDisabled returns true if a program with the given name has been disabled.
+func (c *command) isDisabled(name string) bool {
+	_, err := os.Lstat(filepath.Join(c.disabledDir(), name))
+	return err == nil
+}
+
+func (c *command) disable(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		if c.isDisabled(name) {
+			c.error("%s: already disabled", name)
+			continue
+		}
+		path, _, ok := c.lstatProgram(name)
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(c.disabledDir(), 0o755); err != nil {
+			c.fatal("%s", err)
+		}
+		fmt.Printf("Disabling %s\n", name)
+		dest := filepath.Join(c.disabledDir(), name)
+		if err := moveProgram(path, dest); err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		c.logChange("disable", path, dest)
+	}
+}
+
+func (c *command) enable(opts *options) {
+	c.validate(opts, anyArgs)
+	if len(opts.args) == 0 {
+		files, err := os.ReadDir(c.disabledDir())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.fatal("%s", err)
+		}
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	for _, name := range opts.args {
+		src := filepath.Join(c.disabledDir(), name)
+		path := filepath.Join(c.bin(), name)
+		if !c.isDisabled(name) {
+			c.error("%s: not disabled", name)
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			c.error("%s: exists", name)
+			continue
+		}
+		fmt.Printf("Enabling %s\n", name)
+		if err := moveProgram(src, path); err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		c.logChange("enable", path, "")
+	}
+	// Clean up the directory once nothing is disabled.
+	os.Remove(c.disabledDir())
+}
+
+// moveProgram moves a program from src to dst. If it is a relative symlink and
+// the directory changes, it adjusts the target so that it still resolves.
+func moveProgram(src, dst string) error {
+	relOrAbsTarget, err := os.Readlink(src)
+	if err != nil || filepath.IsAbs(relOrAbsTarget) {
+		return os.Rename(src, dst)
+	}
+	absTarget := ensureAbs(filepath.Dir(src), relOrAbsTarget)
+	newTarget, err := filepath.Rel(filepath.Dir(dst), absTarget)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(newTarget, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,910 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+func (c *command) doctor(opts *options) {
+	cmd := doctorCommand{command: c, findings: []finding{}}
+	cmd.fix = opts.bool('f', "fix")
+	cmd.json = opts.bool('j', "json")
+	cmd.strict = opts.bool('s', "strict")
+	cmd.quick = opts.bool(0, "quick")
+	create := opts.bool('c', "create")
+	c.validate(opts, noArgs)
+	if cmd.fix && cmd.json {
+		c.fatal("%s: cannot use --fix and --json together", c.name)
+	}
+	if create {
+		if _, err := os.Lstat(c.bin()); errors.Is(err, fs.ErrNotExist) {
+			if err := os.MkdirAll(c.bin(), 0o755); err != nil {
+				c.fatal("%s", err)
+			}
+			fmt.Printf("Created %s\n", c.bin())
+		}
+	}
+	if !cmd.quick {
+		cmd.checkPath()
+	}
+	if !cmd.checkBinDir() {
+		cmd.finish()
+		return
+	}
+	cmd.checkDirPermissions()
+	files := c.files()
+	var names []string
+	for i, queue := range cmd.checkFiles(files) {
+		if !skip(files[i]) {
+			names = append(names, files[i].Name())
+			// Only --fix writes state. Do this before fixes, which might
+			// remove the program.
+			if cmd.fix {
+				cmd.recordBroken(files[i].Name(), queue)
+			}
+		}
+		cmd.flush(queue)
+	}
+	cmd.checkCaseCollisions(names)
+	if !cmd.quick {
+		cmd.checkDuplicateTargets(names)
+	}
+	cmd.finish()
+}
+
+// finish prints the summary for --fix or the findings for --json.
+func (c *doctorCommand) finish() {
+	if c.fix {
+		fmt.Printf("Fixed %d, need manual attention %d\n", c.fixed, c.unfixed)
+	}
+	if c.json {
+		printJSON(c.findings)
+	}
+}
+
+type doctorCommand struct {
+	*command
+	fix, json, strict bool
+	// Whether to skip expensive checks.
+	quick bool
+	// Number of problems fixed and not fixed with --fix.
+	fixed, unfixed int
+	findings       []finding
+	// If non-nil, problems and errors are queued here instead of reported.
+	queue *[]queued
+}
+
+// queued is a problem or error found by a worker, to be reported in order.
+type queued struct {
+	finding finding
+	fix     func() error
+	// Error message, used instead of finding if non-empty.
+	err string
+}
+
+// Maximum number of files to check concurrently. Checks mostly wait on the
+// filesystem, so this can exceed the number of CPUs.
+const doctorWorkers = 16
+
+// checkFiles runs per-file checks concurrently and returns the queued problems
+// for each file. Fixes are not attempted until the queues are flushed, so that
+// output and prompts appear in order.
+func (c *doctorCommand) checkFiles(files []fs.DirEntry) [][]queued {
+	// Initialize lazily loaded fields before sharing them between goroutines.
+	c.home()
+	c.bin()
+	c.state()
+	queues := make([][]queued, len(files))
+	sem := make(chan struct{}, doctorWorkers)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, file fs.DirEntry) {
+			defer wg.Done()
+			worker := *c
+			worker.queue = &queues[i]
+			worker.checkFile(file)
+			<-sem
+		}(i, file)
+	}
+	wg.Wait()
+	return queues
+}
+
+// checkFile runs all checks for a single file in the bin directory.
+func (c *doctorCommand) checkFile(file fs.DirEntry) {
+	c.check(file)
+	if skip(file) || c.quick {
+		return
+	}
+	if !c.checkShadowing(file.Name()) {
+		c.checkSystemCollision(file.Name())
+	}
+	c.checkBuiltinCollision(file.Name())
+}
+
+// recordBroken records whether a program is a broken symlink, so that sim prune
+// --older-than knows how long it has been broken.
+func (c *doctorCommand) recordBroken(name string, queue []queued) {
+	for _, q := range queue {
+		if q.err == "" && q.finding.Check == "broken-symlink" {
+			c.brokenSince(name, true)
+			return
+		}
+	}
+	c.markWorking(name)
+}
+
+// flush reports queued problems and errors.
+func (c *doctorCommand) flush(queue []queued) {
+	for _, q := range queue {
+		if q.err != "" {
+			c.command.error("%s", q.err)
+		} else {
+			f := q.finding
+			c.problem(f.Check, f.Severity, f.Path, f.Message, q.fix)
+		}
+	}
+}
+
+// error is like command.error, but queues the error when in a worker.
+func (c *doctorCommand) error(format string, args ...interface{}) {
+	if c.queue != nil {
+		*c.queue = append(*c.queue, queued{err: fmt.Sprintf(format, args...)})
+		return
+	}
+	c.command.error(format, args...)
+}
+
+func (c *doctorCommand) check(file fs.DirEntry) {
+	path := filepath.Join(c.bin(), file.Name())
+	if file.IsDir() {
+		if file.Name() == disabledName {
+			return
+		}
+		c.problem("unexpected-directory", severityWarning, path, "unexpected directory", nil)
+		return
+	}
+	if isLeftover(file.Name()) {
+		c.problem("leftover", severityWarning, path, "leftover temporary or backup file", func() error {
+			return os.Remove(path)
+		})
+		return
+	}
+	if skip(file) {
+		return
+	}
+	c.checkName(file.Name(), path)
+	if c.state().lookup(file.Name()) == nil {
+		c.problem("foreign", severityInfo, path, "not installed by sim", nil)
+	}
+	info, err := os.Stat(path)
+	if isSymlink(file.Type()) && errors.Is(err, fs.ErrNotExist) {
+		c.problem("broken-symlink", severityError, path, "broken symlink", func() error {
+			if !confirm("Remove broken symlink %s?", path) {
+				return errDeclined
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			c.forget(file.Name())
+			return nil
+		})
+		return
+	} else if isSymlinkLoop(err) {
+		c.problem("symlink-cycle", severityError, path, fmt.Sprintf("symlink cycle: %s", strings.Join(symlinkCycle(path), " -> ")), nil)
+		return
+	} else if err != nil {
+		c.error("%s", err)
+		return
+	} else if !isExecutable(info.Mode()) {
+		c.problem("not-executable", severityError, path, "not an executable", func() error {
+			// The target of a symlink is outside the bin directory, so ask
+			// before changing it.
+			if isSymlink(file.Type()) {
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				if !confirm("Make %s executable?", target) {
+					return errDeclined
+				}
+			}
+			// Add execute permission wherever there is read permission.
+			return os.Chmod(path, info.Mode()|(info.Mode()&0o444)>>2)
+		})
+		return
+	} else if !canExecute(path) {
+		c.problem("not-executable-by-user", severityError, path, "not executable by current user", nil)
+		return
+	} else if info.Size() == 0 {
+		c.problem("empty-file", severityError, path, "empty file", nil)
+		return
+	}
+	c.checkPermissions(path, info.Mode())
+	if !c.quick {
+		c.checkChecksum(file.Name(), path)
+		c.checkShim(file.Name(), path)
+		c.checkShebang(path)
+		c.checkArch(path)
+		if runtime.GOOS == "darwin" {
+			c.checkGatekeeper(path)
+		}
+	}
+	if !isSymlink(file.Type()) {
+		return
+	}
+	relOrAbsTarget, err := os.Readlink(path)
+	if err != nil {
+		c.error("%s", err)
+		return
+	}
+	if filepath.IsAbs(relOrAbsTarget) &&
+		strings.HasPrefix(relOrAbsTarget, c.home()+string(filepath.Separator)) {
+		c.problem("absolute-symlink", severityWarning, path, "symlink is absolute (should be relative)", func() error {
+			relTarget, err := filepath.Rel(c.bin(), relOrAbsTarget)
+			if err != nil {
+				return err
+			}
+			return replaceSymlink(relTarget, path)
+		})
+		return
+	}
+}
+
+// checkName checks for characters that make a program awkward or dangerous to
+// invoke from the shell.
+func (c *doctorCommand) checkName(name, path string) {
+	for _, r := range name {
+		var what string
+		switch {
+		case r == utf8.RuneError:
+			what = "invalid UTF-8"
+		case unicode.IsControl(r):
+			what = fmt.Sprintf("control character %U", r)
+		case unicode.IsSpace(r):
+			what = fmt.Sprintf("whitespace %U", r)
+		case !unicode.IsPrint(r):
+			what = fmt.Sprintf("non-printable character %U", r)
+		default:
+			continue
+		}
+		c.problem("bad-name", severityWarning, path, fmt.Sprintf("name %q contains %s", name, what), nil)
+		return
+	}
+}
+
+// systemBinDirs are directories whose programs should not shadow ours.
+var systemBinDirs = []string{
+	"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin",
+	"/opt/homebrew/bin", "/opt/local/bin",
+}
+
+// checkPath checks that the bin directory is on $PATH before system ones.
+func (c *doctorCommand) checkPath() {
+	dirs := pathDirs()
+	index := -1
+	for i, dir := range dirs {
+		if sameDir(dir, c.bin()) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		c.problem("not-in-path", severityWarning, c.bin(), "not in $PATH", nil)
+		return
+	}
+	for _, dir := range dirs[:index] {
+		for _, system := range systemBinDirs {
+			if sameDir(dir, system) {
+				c.problem("path-order", severityWarning, c.bin(), fmt.Sprintf("comes after %s in $PATH", dir), nil)
+				return
+			}
+		}
+	}
+}
+
+// checkShadowing checks that running name will run the program in the bin
+// directory, rather than one earlier in $PATH. It returns true if shadowed.
+func (c *doctorCommand) checkShadowing(name string) bool {
+	for _, path := range findInPath(name) {
+		if sameDir(filepath.Dir(path), c.bin()) {
+			return false
+		}
+		c.problem("shadowed", severityWarning, filepath.Join(c.bin(), name), fmt.Sprintf("shadowed by %s", path), nil)
+		return true
+	}
+	return false
+}
+
+// checkSystemCollision checks that name does not hide a system command, which
+// confuses scripts that expect the system one.
+func (c *doctorCommand) checkSystemCollision(name string) {
+	for _, dir := range systemBinDirs {
+		if sameDir(dir, c.bin()) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			c.problem("system-collision", severityWarning, filepath.Join(c.bin(), name), fmt.Sprintf("hides system command %s", path), nil)
+			return
+		}
+	}
+}
+
+// shellBuiltins are builtins and keywords in common shells. Shells run these
+// instead of searching $PATH, so a program with the same name never runs
+// unless invoked by path.
+var shellBuiltins = map[string]bool{
+	"alias": true, "bg": true, "bind": true, "break": true, "builtin": true,
+	"case": true, "cd": true, "command": true, "continue": true,
+	"declare": true, "dirs": true, "disown": true, "do": true, "done": true,
+	"echo": true, "elif": true, "else": true, "enable": true, "esac": true,
+	"eval": true, "exec": true, "exit": true, "export": true, "false": true,
+	"fc": true, "fg": true, "fi": true, "for": true, "function": true,
+	"getopts": true, "hash": true, "help": true, "history": true, "if": true,
+	"jobs": true, "kill": true, "let": true, "local": true, "logout": true,
+	"popd": true, "printf": true, "pushd": true, "pwd": true, "read": true,
+	"readonly": true, "return": true, "select": true, "set": true,
+	"shift": true, "shopt": true, "source": true, "suspend": true,
+	"test": true, "then": true, "time": true, "times": true, "trap": true,
+	"true": true, "type": true, "typeset": true, "ulimit": true,
+	"umask": true, "unalias": true, "unset": true, "until": true,
+	"wait": true, "while": true, "[": true, "[[": true,
+}
+
+// checkBuiltinCollision checks that name is not a shell builtin.
+func (c *doctorCommand) checkBuiltinCollision(name string) {
+	if shellBuiltins[name] {
+		c.problem("builtin-collision", severityWarning, filepath.Join(c.bin(), name), fmt.Sprintf("%s is a shell builtin (shells will not run this program)", name), nil)
+	}
+}
+
+// checkChecksum checks that a copied or moved program and its source have the
+// same content as when it was installed.
+func (c *doctorCommand) checkChecksum(name, path string) {
+	p := c.state().lookup(name)
+	if p == nil || p.Checksum == "" {
+		return
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		c.error("%s: %s", path, err)
+		return
+	}
+	if sum != p.Checksum {
+		c.problem("checksum-drift", severityWarning, path, "modified since it was installed", nil)
+		return
+	}
+	if p.Origin == "" {
+		return
+	}
+	if sum, err := checksum(p.Origin); err == nil && sum != p.Checksum {
+		c.problem("checksum-drift", severityWarning, path, fmt.Sprintf("source %s has changed since it was installed", p.Origin), nil)
+	}
+}
+
+// checkShim checks that the command a shim execs can be found.
+func (c *doctorCommand) checkShim(name, path string) {
+	p := c.state().lookup(name)
+	if p == nil || p.Mode != modeShim || len(p.Command) == 0 {
+		return
+	}
+	if _, err := exec.LookPath(p.Command[0]); err != nil {
+		c.problem("shim-command-missing", severityError, path, fmt.Sprintf("shim command not found: %s", p.Command[0]), nil)
+	}
+}
+
+// findInPath returns all executables called name in $PATH, in order.
+func findInPath(name string) []string {
+	var paths []string
+	for _, dir := range pathDirs() {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && isExecutable(info.Mode()) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// checkPermissions checks for permissions that allow tampering with a
+// program or that make it run with elevated privileges.
+func (c *doctorCommand) checkPermissions(path string, mode fs.FileMode) {
+	if mode&0o002 != 0 {
+		c.problem("world-writable", severityError, path, "world-writable", func() error {
+			return os.Chmod(path, mode.Perm()&^0o002|mode&(fs.ModeSetuid|fs.ModeSetgid))
+		})
+	}
+	if mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+		c.problem("setuid", severityWarning, path, "has setuid or setgid bit", func() error {
+			if !confirm("Remove setuid/setgid bits from %s?", path) {
+				return errDeclined
+			}
+			return os.Chmod(path, mode.Perm())
+		})
+	}
+}
+
+// checkBinDir checks that the bin directory exists and is a directory. It
+// returns false if there is no directory to check further.
+func (c *doctorCommand) checkBinDir() bool {
+	dir := c.bin()
+	info, err := os.Lstat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.problem("bin-missing", severityError, dir, "does not exist", func() error {
+			return os.MkdirAll(dir, 0o755)
+		})
+		_, err = os.Lstat(dir)
+		return err == nil
+	} else if err != nil {
+		c.error("%s", err)
+		return false
+	}
+	if isSymlink(info.Mode()) {
+		target, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			c.problem("bin-broken-symlink", severityError, dir, fmt.Sprintf("broken symlink: %s", err), nil)
+			return false
+		}
+		if !isUnder(target, c.home()) {
+			c.problem("bin-symlink", severityWarning, dir, fmt.Sprintf("symlink to %s, outside home directory", target), nil)
+		}
+		if info, err = os.Stat(dir); err != nil {
+			c.error("%s", err)
+			return false
+		}
+	}
+	if !info.IsDir() {
+		c.problem("bin-not-directory", severityError, dir, "not a directory", nil)
+		return false
+	}
+	return true
+}
+
+// checkDirPermissions checks that the bin directory and its ancestors cannot
+// be modified by other users.
+func (c *doctorCommand) checkDirPermissions() {
+	for dir := c.bin(); ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			c.error("%s", err)
+			return
+		}
+		mode := info.Mode()
+		// The sticky bit (as on /tmp) prevents others from replacing entries.
+		if mode&0o022 != 0 && mode&fs.ModeSticky == 0 {
+			var fix func() error
+			// Leave directories owned by others, like shared ones, to their owners.
+			if ownedByUser(info) {
+				dir := dir
+				fix = func() error {
+					if !confirm("Remove group and world write permission from %s?", dir) {
+						return errDeclined
+					}
+					return os.Chmod(dir, mode&(fs.ModeSetgid|fs.ModeSticky)|mode.Perm()&^0o022)
+				}
+			}
+			c.problem("dir-writable", severityError, dir, "directory on path to bin dir is group- or world-writable", fix)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return
+		}
+	}
+}
+
+// checkShebang checks that the interpreter of a script exists.
+func (c *doctorCommand) checkShebang(path string) {
+	line, err := readShebang(path)
+	if err != nil {
+		c.error("%s: %s", path, err)
+		return
+	}
+	if strings.HasSuffix(line, "\r") {
+		c.problem("shebang-crlf", severityError, path, "shebang line ends in CRLF (causes \"bad interpreter\" errors)", func() error {
+			if !confirm("Convert %s to LF line endings?", path) {
+				return errDeclined
+			}
+			return convertCRLF(path)
+		})
+		return
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		if line != "" {
+			c.problem("shebang-empty", severityError, path, "empty shebang", nil)
+		}
+		return
+	}
+	interpreter := fields[0]
+	if filepath.Base(interpreter) == "env" {
+		// Skip env options like -S to find the program it runs.
+		for _, arg := range fields[1:] {
+			if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+				continue
+			}
+			if len(findInPath(arg)) == 0 {
+				c.problem("interpreter-missing", severityError, path, fmt.Sprintf("interpreter %s not found in $PATH", arg), nil)
+			}
+			break
+		}
+	}
+	if info, err := os.Stat(interpreter); err != nil {
+		c.problem("interpreter-missing", severityError, path, fmt.Sprintf("interpreter %s not found", interpreter), nil)
+	} else if info.IsDir() || !isExecutable(info.Mode()) {
+		c.problem("interpreter-not-executable", severityError, path, fmt.Sprintf("interpreter %s is not executable", interpreter), nil)
+	} else if !canExecute(interpreter) {
+		c.problem("interpreter-not-executable", severityError, path, fmt.Sprintf("interpreter %s is not executable by current user", interpreter), nil)
+	}
+}
+
+// readShebang returns the first line of the file at path (without the line
+// terminator) if it starts with "#!", and "" otherwise.
+func readShebang(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// checkArch checks that a binary was built for this OS and architecture.
+func (c *doctorCommand) checkArch(path string) {
+	if typ, err := programType(path); err != nil || typ != typeBinary {
+		return
+	}
+	if err := checkTruncated(path); err != nil {
+		c.problem("truncated", severityError, path, err.Error(), nil)
+		return
+	}
+	info, err := readBinaryInfo(path)
+	if err != nil {
+		c.problem("binary-header", severityWarning, path, fmt.Sprintf("cannot parse binary: %s", err), nil)
+		return
+	}
+	if err := info.runsOnHost(); err != nil {
+		c.problem("arch-mismatch", severityError, path, err.Error(), nil)
+	}
+}
+
+const quarantineAttr = "com.apple.quarantine"
+
+// checkGatekeeper checks for problems that make macOS refuse to run a program.
+func (c *doctorCommand) checkGatekeeper(path string) {
+	if err := exec.Command("xattr", "-p", quarantineAttr, path).Run(); err == nil {
+		c.problem("quarantine", severityError, path, "has quarantine attribute", func() error {
+			return exec.Command("xattr", "-d", quarantineAttr, path).Run()
+		})
+	}
+	if typ, err := programType(path); err != nil || typ != typeBinary {
+		return
+	}
+	if out, err := exec.Command("codesign", "--verify", path).CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		msg = strings.TrimPrefix(msg, path+": ")
+		// Only Apple silicon refuses to run unsigned binaries, so Go only
+		// ad-hoc signs them there.
+		if strings.Contains(msg, "not signed at all") && runtime.GOARCH != "arm64" {
+			return
+		}
+		c.problem("code-signature", severityError, path, fmt.Sprintf("invalid code signature: %s", msg), func() error {
+			if !confirm("Ad-hoc sign %s?", path) {
+				return errDeclined
+			}
+			return exec.Command("codesign", "--force", "--sign", "-", path).Run()
+		})
+	}
+}
+
+// convertCRLF replaces CRLF line endings with LF in the file at path.
+func convertCRLF(path string) error {
+	// Resolve symlinks so that we replace the target, not the symlink.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return writeFileAtomic(path, data, info.Mode().Perm())
+}
+
+// checkCaseCollisions checks for names that differ only by case, which
+// collide on case-insensitive filesystems.
+func (c *doctorCommand) checkCaseCollisions(names []string) {
+	groups := make(map[string][]string)
+	var keys []string
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], name)
+	}
+	for _, key := range keys {
+		if group := groups[key]; len(group) > 1 {
+			c.problem("case-collision", severityWarning, filepath.Join(c.bin(), group[0]), fmt.Sprintf("differs only by case from %s", strings.Join(group[1:], ", ")), nil)
+		}
+	}
+}
+
+// checkDuplicateTargets checks for programs that resolve to the same file.
+func (c *doctorCommand) checkDuplicateTargets(names []string) {
+	groups := make(map[string][]string)
+	var targets []string
+	for _, name := range names {
+		target, err := filepath.EvalSymlinks(filepath.Join(c.bin(), name))
+		if err != nil {
+			continue
+		}
+		if _, ok := groups[target]; !ok {
+			targets = append(targets, target)
+		}
+		groups[target] = append(groups[target], name)
+	}
+	for _, target := range targets {
+		if group := c.withoutAliases(groups[target]); len(group) > 1 {
+			c.problem("duplicate-target", severityWarning, target, fmt.Sprintf("target of multiple programs: %s", strings.Join(group, ", ")), nil)
+		}
+	}
+}
+
+// withoutAliases returns the names in group that are not tracked aliases of
+// another name in group, since sim alias, sim switch, and sim dedupe create
+// those on purpose.
+func (c *doctorCommand) withoutAliases(group []string) []string {
+	members := make(map[string]bool, len(group))
+	for _, name := range group {
+		members[name] = true
+	}
+	var result []string
+	for _, name := range group {
+		if !members[c.state().lookup(name).original()] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// symlinkCycle follows the symlink chain starting at path and returns the
+// paths that form a cycle, ending with the first repeated one. If there is no
+// cycle, it returns the whole chain, ending with the first path that is not a
+// symlink (or the last one read if the chain is too long).
+func symlinkCycle(path string) []string {
+	var chain []string
+	seen := make(map[string]int)
+	for len(chain) < 255 {
+		if i, ok := seen[path]; ok {
+			return append(chain[i:], path)
+		}
+		seen[path] = len(chain)
+		chain = append(chain, path)
+		target, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+		path = ensureAbs(filepath.Dir(path), target)
+		// Resolve symlinks in the directory but not the final element.
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			path = filepath.Join(dir, filepath.Base(path))
+		}
+	}
+	return chain
+}
+
+// pathDirs returns the directories in $PATH.
+func pathDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// sameDir returns true if a and b refer to the same directory.
+func sameDir(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	x, err1 := os.Stat(a)
+	y, err2 := os.Stat(b)
+	return err1 == nil && err2 == nil && os.SameFile(x, y)
+}
+
+var errDeclined = errors.New("declined")
+
+// finding is a problem found by doctor.
+type finding struct {
+	// Identifier for the kind of problem, like "broken-symlink".
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	// Shell command that would fix the problem, if known.
+	Hint string `json:"hint,omitempty"`
+	// Whether --fix fixed the problem.
+	Fixed bool `json:"fixed,omitempty"`
+}
+
+// Severities for findings.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+func (f finding) String() string {
+	if f.Severity == severityError {
+		return fmt.Sprintf("%s: %s", f.Path, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Path, f.Severity, f.Message)
+}
+
+// problem reports a problem with path. If fix is non-nil and --fix was given,
+// it calls fix to try fixing the problem.
+func (c *doctorCommand) problem(check, severity, path, msg string, fix func() error) {
+	f := finding{Check: check, Severity: severity, Path: path, Message: msg}
+	f.Hint = c.hint(check, path)
+	if c.queue != nil {
+		*c.queue = append(*c.queue, queued{finding: f, fix: fix})
+		return
+	}
+	defer func() {
+		c.findings = append(c.findings, f)
+	}()
+	if !c.fix {
+		c.report(f, "")
+		return
+	}
+	if fix == nil {
+		c.report(f, " (cannot fix automatically)")
+		c.unfixed++
+		return
+	}
+	if err := fix(); errors.Is(err, errDeclined) {
+		c.report(f, " (not fixed)")
+		c.unfixed++
+	} else if err != nil {
+		c.report(f, fmt.Sprintf(" (fix failed: %s)", err))
+		c.unfixed++
+	} else {
+		fmt.Printf("Fixed %s\n", f)
+		c.logChange("fix", f.Path, f.Check)
+		f.Fixed = true
+		c.fixed++
+	}
+}
+
+// report prints an unfixed finding to stderr (unless printing JSON) with an
+// optional note, and marks the command as failed if it is severe enough.
+func (c *doctorCommand) report(f finding, note string) {
+	if !c.json {
+		fmt.Fprintf(os.Stderr, "%s%s\n", f, note)
+		if f.Hint != "" {
+			fmt.Fprintf(os.Stderr, "    run: %s\n", f.Hint)
+		}
+	}
+	if f.Severity == severityError || c.strict && f.Severity == severityWarning {
+		c.failed = true
+	}
+}
+
+// hint returns a shell command that would fix a problem found by check, or ""
+// if there is no simple fix.
+func (c *doctorCommand) hint(check, path string) string {
+	name := filepath.Base(path)
+	switch check {
+	case "bin-missing":
+		return "sim doctor --create"
+	case "not-in-path", "path-order":
+		return fmt.Sprintf("export PATH=%s:$PATH", shellQuote(c.bin()))
+	case "dir-writable":
+		return fmt.Sprintf("chmod go-w %s", shellQuote(path))
+	case "leftover":
+		return "sim prune"
+	case "broken-symlink", "symlink-cycle", "empty-file", "truncated", "shim-command-missing":
+		return fmt.Sprintf("sim remove %s", shellQuote(name))
+	case "not-executable", "not-executable-by-user":
+		return fmt.Sprintf("chmod +x %s", shellQuote(path))
+	case "world-writable":
+		return fmt.Sprintf("chmod o-w %s", shellQuote(path))
+	case "setuid":
+		return fmt.Sprintf("chmod ug-s %s", shellQuote(path))
+	case "shebang-crlf":
+		return "sim doctor --fix"
+	case "quarantine":
+		return fmt.Sprintf("xattr -d %s %s", quarantineAttr, shellQuote(path))
+	case "code-signature":
+		return fmt.Sprintf("codesign --force --sign - %s", shellQuote(path))
+	case "checksum-drift":
+		if p := c.state().lookup(name); p != nil && p.Origin != "" {
+			return fmt.Sprintf("sim update %s", shellQuote(name))
+		} else if p != nil && p.Mode == modeShim {
+			return shimHint(name, p.Command)
+		}
+	case "absolute-symlink":
+		if target, err := os.Readlink(path); err == nil {
+			return installHint("-f", name, target)
+		}
+	}
+	return ""
+}
+
+// installHint returns a sim install command that installs target as name.
+func installHint(flags, name, target string) string {
+	if filepath.Base(target) != name {
+		flags += " -r " + shellQuote(name)
+	}
+	return fmt.Sprintf("sim install %s %s", flags, shellQuote(target))
+}
+
+// shimHint returns a sim shim command that recreates a shim.
+func shimHint(name string, argv []string) string {
+	return fmt.Sprintf("sim shim -f %s -- %s", shellQuote(name), shellJoin(argv))
+}
+
+// shellQuote quotes s for the shell if it contains special characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-.,/:+=@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellJoin quotes and joins words into a shell command line.
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// replaceSymlink atomically replaces the symlink at path with one pointing to
+// target.
+func replaceSymlink(target, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func (c *command) each(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	errExit := opts.bool('e', "errexit")
+	verbose := opts.bool('v', "verbose")
+	patterns := opts.strings('m', "match")
+	c.validate(opts, atLeastOneArg)
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			c.fatal("%s: --match %s: %s", c.name, pattern, err)
+		}
+	}
+	argv := opts.args
+	if !hasPlaceholder(argv) {
+		argv = append(argv, "{}")
+	}
+	needTarget := strings.Contains(strings.Join(argv, " "), "{target}")
+	var names []string
+	for _, file := range c.files() {
+		if !skip(file) && matchAny(patterns, file.Name()) {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return naturalLess(names[i], names[j])
+	})
+	for _, name := range names {
+		path := filepath.Join(c.bin(), name)
+		target := path
+		if needTarget {
+			var ok bool
+			if target, ok = c.resolve(name); !ok {
+				if errExit {
+					return
+				}
+				continue
+			}
+		}
+		r := strings.NewReplacer("{}", name, "{path}", path, "{target}", target)
+		args := make([]string, len(argv))
+		for i, arg := range argv {
+			args[i] = r.Replace(arg)
+		}
+		if dryRun || verbose {
+			fmt.Println(shellJoin(args))
+		}
+		if dryRun {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			c.error("%s: %s: %s", name, args[0], err)
+			if errExit {
+				return
+			}
+		}
+	}
+}
+
+// hasPlaceholder returns true if any of args contains a placeholder for sim
+// each to substitute.
+func hasPlaceholder(args []string) bool {
+	for _, arg := range args {
+		for _, p := range []string{"{}", "{path}", "{target}"} {
+			if strings.Contains(arg, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAny returns true if name matches any of the glob patterns, or if there
+// are no patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return len(patterns) == 0
+}
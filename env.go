@@ -0,0 +1,58 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envVars are the variables sim reads, besides $XDG_BIN_HOME. The env command
+// only exports them when they are set, since sim has defaults for them.
+var envVars = []string{"XDG_STATE_HOME", "XDG_DATA_HOME", "XDG_CONFIG_HOME"}
+
+func (c *command) env(opts *options) {
+	shell := opts.string('s', "shell")
+	c.validate(opts, noArgs)
+	if shell == "" {
+		if shell = filepath.Base(os.Getenv("SHELL")); shell == "." {
+			shell = "sh"
+		}
+	}
+	switch shell {
+	case "sh", "bash", "zsh", "ksh", "dash", "posix":
+		fmt.Print(c.posixEnv())
+	case "fish":
+		fmt.Print(c.fishEnv())
+	default:
+		c.fatal("%s: %s: unsupported shell (expected a POSIX shell or fish)", c.name, shell)
+	}
+}
+
+func (c *command) posixEnv() string {
+	var b strings.Builder
+	bin := shellQuote(c.bin())
+	fmt.Fprintf(&b, "export XDG_BIN_HOME=%s\n", bin)
+	for _, key := range envVars {
+		if value := os.Getenv(key); value != "" {
+			fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(value))
+		}
+	}
+	fmt.Fprintf(&b, "case \":${PATH}:\" in *:%s:*) ;; *) export PATH=%s\"${PATH:+:$PATH}\" ;; esac\n", bin, bin)
+	return b.String()
+}
+
+func (c *command) fishEnv() string {
+	var b strings.Builder
+	bin := fishQuote(c.bin())
+	fmt.Fprintf(&b, "set -gx XDG_BIN_HOME %s\n", bin)
+	for _, key := range envVars {
+		if value := os.Getenv(key); value != "" {
+			fmt.Fprintf(&b, "set -gx %s %s\n", key, fishQuote(value))
+		}
+	}
+	fmt.Fprintf(&b, "contains -- %s $PATH; or set -gx PATH %s $PATH\n", bin, bin)
+	return b.String()
+}
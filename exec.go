@@ -0,0 +1,26 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func (c *command) exec(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	name, args := opts.args[0], opts.args[1:]
+	path, _, ok := c.lstatProgram(name)
+	if !ok {
+		return
+	}
+	if p := c.state().lookup(name); p != nil {
+		p.LastRun = stamp()
+		c.modified()
+		c.saveState()
+	}
+	// Replace this process so that the program's exit status and signals
+	// behave exactly as if it were run directly.
+	err := syscall.Exec(path, append([]string{path}, args...), os.Environ())
+	c.error("%s: %s", name, err)
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) freeze(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		c.freezeProgram(name)
+	}
+}
+
+// freezeProgram replaces a symlink in the bin directory with a copy of its
+// target, recording the target as the copy's origin.
+func (c *command) freezeProgram(name string) {
+	path, info, ok := c.lstatProgram(name)
+	if !ok {
+		return
+	}
+	if !isSymlink(info.Mode()) {
+		c.error("%s: not a symlink", name)
+		return
+	}
+	relOrAbsTarget, err := os.Readlink(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	absTarget := ensureAbs(c.bin(), relOrAbsTarget)
+	if _, err := os.Stat(absTarget); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	fmt.Printf("Freezing %s %s %s\n", name, brightBlack("from"), blue(absTarget))
+	if err := replaceWithCopy(absTarget, path); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+	}
+	p := c.state().program(name)
+	c.logChange("freeze", path, absTarget)
+	p.Mode = modeCopy
+	p.Origin = absTarget
+	p.Checksum = sum
+	p.TargetChecksum = ""
+	p.Installed = stamp()
+	c.modified()
+}
+
+func (c *command) thaw(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	for _, name := range c.copies(opts.args) {
+		c.thawProgram(name, force)
+	}
+}
+
+// thawProgram replaces a copied program with a symlink to its origin, unless
+// the origin's content differs and force is false.
+func (c *command) thawProgram(name string, force bool) {
+	p := c.state().lookup(name)
+	installed, _, ok := c.compareOrigin(name)
+	if !ok {
+		return
+	}
+	if installed != nil && !force {
+		c.error("%s: differs from origin %s (thaw anyway with --force)", name, p.Origin)
+		return
+	}
+	relTarget, err := filepath.Rel(c.bin(), p.Origin)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	fmt.Printf("Thawing %s %s %s\n", name, brightBlack("->"), blue(p.Origin))
+	if err := replaceSymlink(relTarget, filepath.Join(c.bin(), name)); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	c.logChange("thaw", filepath.Join(c.bin(), name), p.Origin)
+	p.Mode = modeSymlink
+	p.TargetChecksum, _ = checksum(p.Origin)
+	p.Origin = ""
+	p.Checksum = ""
+	p.Installed = stamp()
+	c.modified()
+}
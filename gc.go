@@ -0,0 +1,139 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadExpiry is how old a leftover download from selfupdate must be before
+// gc removes it, so that it does not interfere with an update in progress.
+const downloadExpiry = time.Hour
+
+type gcCommand struct {
+	*command
+	dryRun bool
+	// Total size of the files removed, or that would be removed.
+	reclaimed int64
+}
+
+func (c *command) gc(opts *options) {
+	cmd := gcCommand{command: c}
+	cmd.dryRun = opts.bool('n', "dry-run")
+	keepArg := opts.string('k', "keep")
+	backupDir := opts.string('b', "backup")
+	c.validate(opts, noArgs)
+	keep := 2
+	if keepArg != "" {
+		var err error
+		if keep, err = strconv.Atoi(keepArg); err != nil || keep < 0 {
+			c.fatal("%s: --keep: invalid number: %s", c.name, keepArg)
+		}
+	}
+	for _, file := range c.files() {
+		if !skip(file) && isSymlink(file.Type()) && c.activeVersion(file.Name()) != "" {
+			cmd.collectVersions(file.Name(), keep)
+		}
+	}
+	cmd.collectExpired(c.undoDir(), backupExpiry)
+	if backupDir != "" {
+		cmd.collectExpired(c.abs(backupDir), backupExpiry)
+	}
+	cmd.collectDownloads()
+	verb := "Reclaimed"
+	if cmd.dryRun {
+		verb = "Would reclaim"
+	}
+	fmt.Printf("%s %s\n", verb, formatSize(cmd.reclaimed))
+}
+
+// collectVersions removes inactive versions of a program other than the newest
+// keep, the one sim rollback would switch to, and pinned ones.
+func (c *gcCommand) collectVersions(name string, keep int) {
+	active := c.activeVersion(name)
+	previous := c.state().lookup(name).previous()
+	versions := c.versions(name)
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		versionName := name + "-" + version
+		if version == active || version == previous || c.state().lookup(versionName).pinned() {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		path := filepath.Join(c.bin(), versionName)
+		target := linkTarget(path)
+		if !c.remove(path) {
+			continue
+		}
+		c.logChange("remove", path, target)
+		c.forget(versionName)
+	}
+}
+
+// collectExpired removes backups in dir older than expiry.
+func (c *gcCommand) collectExpired(dir string, expiry time.Duration) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		c.fatal("reading %s: %s", dir, err)
+	}
+	for _, file := range files {
+		if created, ok := parseBackupName(file.Name()); ok && time.Since(created) >= expiry {
+			c.remove(filepath.Join(dir, file.Name()))
+		}
+	}
+}
+
+// collectDownloads removes files left behind by interrupted selfupdates.
+func (c *gcCommand) collectDownloads() {
+	dir := os.TempDir()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "sim-download-") {
+			continue
+		}
+		if info, err := file.Info(); err == nil && time.Since(info.ModTime()) >= downloadExpiry {
+			c.remove(filepath.Join(dir, file.Name()))
+		}
+	}
+}
+
+// remove deletes a file and adds its size to the reclaimed total, or just
+// reports it for dry runs. It returns true if the file was removed.
+func (c *gcCommand) remove(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		c.error("%s: %s", path, err)
+		return false
+	}
+	size := info.Size()
+	verb := "Removing"
+	if c.dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %s %s\n", verb, blue(path), brightBlack("("+formatSize(size)+")"))
+	c.reclaimed += size
+	if c.dryRun {
+		return false
+	}
+	if err := os.Remove(path); err != nil {
+		c.reclaimed -= size
+		c.error("%s: %s", path, err)
+		return false
+	}
+	return true
+}
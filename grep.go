@@ -0,0 +1,77 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+func (c *command) grep(opts *options) {
+	ignoreCase := opts.bool('i', "ignore-case")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 1 {
+		c.fatal("%s: expected a single PATTERN", c.name)
+	}
+	pattern := opts.args[0]
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		c.fatal("%s: %s", opts.args[0], err)
+	}
+	searched := make(map[string]bool)
+	var found bool
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		name := file.Name()
+		target, err := filepath.EvalSymlinks(filepath.Join(c.bin(), name))
+		if err != nil || searched[target] {
+			continue
+		}
+		// Search each file once, even if several programs resolve to it.
+		searched[target] = true
+		if typ, err := programType(target); err != nil || typ != typeScript {
+			continue
+		}
+		if c.grepFile(name, target, re) {
+			found = true
+		}
+	}
+	// Like grep, exit with status 1 if nothing matched.
+	if !found {
+		c.failed = true
+	}
+}
+
+// grepFile prints lines in the file at path that match re, and returns true
+// if there were any.
+func (c *command) grepFile(name, path string, re *regexp.Regexp) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return false
+	}
+	defer f.Close()
+	var found bool
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if !re.MatchString(line) {
+			continue
+		}
+		found = true
+		fmt.Printf("%s%s%d%s%s\n", blue(name), brightBlack(":"), n, brightBlack(":"), line)
+	}
+	if err := scanner.Err(); err != nil {
+		c.error("%s: %s", name, err)
+	}
+	return found
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+func (c *command) info(opts *options) {
+	json := opts.bool('j', "json")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 1 {
+		c.fatal("%s: expected a single NAME", c.name)
+	}
+	info, ok := c.programInfo(opts.args[0])
+	if !ok {
+		return
+	}
+	if json {
+		printJSON(info)
+		return
+	}
+	info.print()
+}
+
+// programInfo is everything sim knows about a program.
+type programInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// How the program was installed (modeSymlink, modeCopy, modeMove, or
+	// modeShim), or "symlink" or "file" if it was not installed by sim.
+	Kind string `json:"kind"`
+	// Symlinks followed from Path, ending with the resolved file.
+	Targets   []string   `json:"targets,omitempty"`
+	Broken    bool       `json:"broken,omitempty"`
+	Type      string     `json:"type,omitempty"`
+	Size      int64      `json:"size"`
+	Mode      string     `json:"mode"`
+	Modified  time.Time  `json:"modified"`
+	Checksum  string     `json:"checksum,omitempty"`
+	Managed   bool       `json:"managed"`
+	Origin    string     `json:"origin,omitempty"`
+	Installed *time.Time `json:"installed,omitempty"`
+	Pinned    bool       `json:"pinned,omitempty"`
+	AliasOf   string     `json:"aliasOf,omitempty"`
+	Resources []string   `json:"resources,omitempty"`
+	Issues    []finding  `json:"issues"`
+}
+
+// programInfo gathers information about a program. It reports an error and
+// returns false if the program does not exist.
+func (c *command) programInfo(name string) (programInfo, bool) {
+	path, linfo, ok := c.lstatProgram(name)
+	if !ok {
+		return programInfo{}, false
+	}
+	info := programInfo{Name: name, Path: path, Kind: "file", Issues: []finding{}}
+	if isSymlink(linfo.Mode()) {
+		info.Kind = "symlink"
+		info.Targets = symlinkCycle(path)[1:]
+	}
+	if p := c.state().lookup(name); p != nil {
+		info.Managed = true
+		if p.Mode != "" {
+			info.Kind = p.Mode
+		}
+		info.Origin = p.Origin
+		info.Installed = p.Installed
+		info.Pinned = p.Pinned
+		info.AliasOf = p.Original
+		info.Resources = p.Resources
+	}
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+		info.Mode = stat.Mode().String()
+		info.Modified = stat.ModTime()
+		info.Type, _ = programType(path)
+		info.Checksum, _ = checksum(path)
+	} else {
+		info.Broken = true
+		info.Mode = linfo.Mode().String()
+		info.Modified = linfo.ModTime()
+	}
+	// Run the doctor checks for this program, queuing instead of reporting.
+	var queue []queued
+	doctor := doctorCommand{command: c, queue: &queue}
+	doctor.checkFile(fs.FileInfoToDirEntry(linfo))
+	for _, q := range queue {
+		if q.err != "" {
+			q.finding = finding{Check: "error", Severity: severityError, Path: path, Message: q.err}
+		}
+		if q.finding.Check != "foreign" {
+			info.Issues = append(info.Issues, q.finding)
+		}
+	}
+	return info, true
+}
+
+func (info programInfo) print() {
+	field := func(key, format string, args ...interface{}) {
+		fmt.Printf("%-10s %s\n", key+":", fmt.Sprintf(format, args...))
+	}
+	field("Name", "%s", info.Name)
+	field("Path", "%s", info.Path)
+	field("Kind", "%s", info.Kind)
+	if len(info.Targets) > 0 {
+		target := blue(strings.Join(info.Targets, " -> "))
+		if info.Broken {
+			target = red(strings.Join(info.Targets, " -> ")) + " " + brightBlack("(broken)")
+		}
+		field("Target", "%s", target)
+	}
+	if info.Type != "" {
+		field("Type", "%s", info.Type)
+	}
+	if !info.Broken {
+		field("Size", "%s", formatSize(info.Size))
+	}
+	field("Mode", "%s", info.Mode)
+	field("Modified", "%s", info.Modified.Format(time.RFC3339))
+	if info.Checksum != "" {
+		field("SHA-256", "%s", info.Checksum)
+	}
+	if !info.Managed {
+		field("Managed", "no")
+	}
+	if info.Origin != "" {
+		field("Origin", "%s", blue(info.Origin))
+	}
+	if info.Installed != nil {
+		field("Installed", "%s", info.Installed.Format(time.RFC3339))
+	}
+	if info.Pinned {
+		field("Pinned", "yes")
+	}
+	if info.AliasOf != "" {
+		field("Alias of", "%s", info.AliasOf)
+	}
+	for i, resource := range info.Resources {
+		key := ""
+		if i == 0 {
+			key = "Resources"
+		}
+		fmt.Printf("%-10s %s\n", key+":", resource)
+	}
+	if len(info.Issues) == 0 {
+		field("Issues", "none")
+		return
+	}
+	for i, issue := range info.Issues {
+		key := ""
+		if i == 0 {
+			key = "Issues"
+		}
+		msg := issue.Message
+		if issue.Severity != severityError {
+			msg = issue.Severity + ": " + msg
+		}
+		fmt.Printf("%-10s %s\n", key+":", red(msg))
+	}
+}
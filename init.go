@@ -0,0 +1,177 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func (c *command) init(opts *options) {
+	noCompletion := opts.bool(0, "no-completion")
+	prompt := opts.bool('p', "prompt")
+	track := opts.bool('t', "track")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	if track {
+		// Create it now so that the hook does not have to.
+		if err := os.MkdirAll(c.usedDir(), 0o755); err != nil {
+			c.fatal("%s", err)
+		}
+	}
+	var b strings.Builder
+	switch shell := opts.args[0]; shell {
+	case "bash":
+		b.WriteString(c.posixEnv())
+		if !noCompletion {
+			b.WriteString(bashCompletion())
+		}
+		if prompt {
+			b.WriteString(c.bashPromptHook())
+		}
+		if track {
+			b.WriteString(c.bashTrackHook())
+		}
+	case "zsh":
+		b.WriteString(c.posixEnv())
+		if !noCompletion {
+			// The completion script needs compinit to have run already.
+			b.WriteString("if (( $+functions[compdef] )); then\n")
+			b.WriteString(zshCompletion())
+			b.WriteString("fi\n")
+		}
+		if prompt {
+			b.WriteString(c.zshPromptHook())
+		}
+		if track {
+			b.WriteString(c.zshTrackHook())
+		}
+	case "fish":
+		b.WriteString(c.fishEnv())
+		if !noCompletion {
+			b.WriteString(fishCompletion())
+		}
+		if prompt {
+			b.WriteString(c.fishPromptHook())
+		}
+		if track {
+			b.WriteString(c.fishTrackHook())
+		}
+	default:
+		c.fatal("%s: %s: unsupported shell (expected bash, zsh, or fish)", c.name, shell)
+	}
+	fmt.Print(b.String())
+}
+
+// The prompt hooks warn about broken symlinks in the bin directory. They only
+// print when the set of broken symlinks changes, so the warning is not
+// repeated before every prompt.
+
+func (c *command) bashPromptHook() string {
+	return fmt.Sprintf(`
+_sim_prompt() {
+    local f broken=
+    for f in %s/*; do
+        [[ -L $f && ! -e $f ]] && broken+=" ${f##*/}"
+    done
+    if [[ $broken != "$_sim_broken" ]]; then
+        _sim_broken=$broken
+        [[ -n $broken ]] && echo "sim: broken symlinks:$broken (run sim prune)" >&2
+    fi
+    return 0
+}
+
+PROMPT_COMMAND="_sim_prompt${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`, shellQuote(c.bin()))
+}
+
+func (c *command) zshPromptHook() string {
+	return fmt.Sprintf(`
+_sim_prompt() {
+    local f broken=
+    for f in %s/*(N-@); do
+        broken+=" ${f:t}"
+    done
+    if [[ $broken != "$_sim_broken" ]]; then
+        _sim_broken=$broken
+        [[ -n $broken ]] && print -u2 "sim: broken symlinks:$broken (run sim prune)"
+    fi
+    return 0
+}
+
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd _sim_prompt
+`, shellQuote(c.bin()))
+}
+
+func (c *command) fishPromptHook() string {
+	return fmt.Sprintf(`
+function _sim_prompt --on-event fish_prompt
+    set -l broken
+    for f in %s/*
+        if test -L $f; and not test -e $f
+            set broken $broken (basename -- $f)
+        end
+    end
+    if test "$broken" != "$_sim_broken"
+        set -g _sim_broken "$broken"
+        test -n "$broken"; and echo "sim: broken symlinks: $broken (run sim prune)" >&2
+    end
+end
+`, fishQuote(c.bin()))
+}
+
+// The track hooks record when programs in the bin directory are run from the
+// shell, for sim unused. They truncate an empty file named after the program in
+// usedDir to update its modification time, using only shell builtins.
+
+func (c *command) bashTrackHook() string {
+	return fmt.Sprintf(`
+_sim_track() {
+    local n cmd
+    # Bash has no preexec hook, so check the last history entry instead.
+    read -r n cmd _ <<< "$(HISTTIMEFORMAT= builtin history 1)"
+    if [[ -z $_sim_track_last ]]; then
+        _sim_track_last=${n:--}
+        return 0
+    fi
+    [[ $n == "$_sim_track_last" ]] && return 0
+    _sim_track_last=$n
+    if [[ -n $cmd && $cmd != */* && -f %[1]s/$cmd ]]; then
+        : 2>/dev/null >| %[2]s/"$cmd"
+    fi
+    return 0
+}
+
+PROMPT_COMMAND="_sim_track${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`, shellQuote(c.bin()), shellQuote(c.usedDir()))
+}
+
+func (c *command) zshTrackHook() string {
+	return fmt.Sprintf(`
+_sim_track() {
+    local cmd=${${(z)1}[1]}
+    if [[ -n $cmd && $cmd != */* && -f %[1]s/$cmd ]]; then
+        : 2>/dev/null >| %[2]s/$cmd
+    fi
+    return 0
+}
+
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec _sim_track
+`, shellQuote(c.bin()), shellQuote(c.usedDir()))
+}
+
+func (c *command) fishTrackHook() string {
+	return fmt.Sprintf(`
+function _sim_track --on-event fish_preexec
+    set -l cmd (string match -r -- '^\S+' (string trim -- $argv[1]))
+    if test -n "$cmd"; and not string match -q -- '*/*' $cmd; and test -f %[1]s/$cmd
+        true 2>/dev/null >%[2]s/$cmd
+    end
+end
+`, fishQuote(c.bin()), fishQuote(c.usedDir()))
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalEntry records a sim command that changed the bin directory. The
+// journal is stored as JSON lines in $XDG_STATE_HOME/sim/journal.jsonl.
+type journalEntry struct {
+	Time    time.Time `json:"time"`
+	Args    []string  `json:"args"`
+	Changes []change  `json:"changes"`
+	// Time of the entry that this one undid, if it is from sim undo.
+	Undid *time.Time `json:"undid,omitempty"`
+	// Indexes of changes in the undone entry that could not be reversed, so
+	// that running sim undo again retries them.
+	Failed []int `json:"failed,omitempty"`
+}
+
+// change is a single modification made by a command.
+type change struct {
+	// What happened, like "install" or "remove".
+	Action string `json:"action"`
+	// Absolute path of the affected file.
+	Path string `json:"path"`
+	// Symlink target, source file, or new name, depending on the action.
+	Target string `json:"target,omitempty"`
+	// Where a removed file was moved to, so that it can be restored.
+	Backup string `json:"backup,omitempty"`
+	// Metadata for the program before the change, if there was any.
+	State *programState `json:"state,omitempty"`
+}
+
+func (c *command) journalFile() string {
+	return filepath.Join(c.stateHome(), "sim", "journal.jsonl")
+}
+
+// logChange records a change to be written to the journal. It should be called
+// before updating the program's metadata, so that sim undo can restore it.
+func (c *command) logChange(action, path, target string) {
+	c.logBackup(action, path, target, "")
+}
+
+// logBackup is like logChange, but also records where the file was backed up.
+func (c *command) logBackup(action, path, target, backup string) {
+	ch := change{Action: action, Path: path, Target: target, Backup: backup}
+	c.dir = nil
+	if filepath.Dir(path) == c.bin() {
+		if p := c.state().lookup(filepath.Base(path)); p != nil {
+			prev := *p
+			ch.State = &prev
+		}
+	}
+	c.changes = append(c.changes, ch)
+}
+
+// saveJournal appends an entry for the changes made by this command, if any.
+func (c *command) saveJournal() {
+	if len(c.changes) == 0 {
+		return
+	}
+	entry := journalEntry{Time: time.Now(), Args: c.args, Changes: c.changes, Undid: c.undid, Failed: c.undoFailed}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		c.fatal("encoding journal: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.journalFile()), 0o755); err != nil {
+		c.fatal("writing journal: %s", err)
+	}
+	f, err := os.OpenFile(c.journalFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		c.fatal("writing journal: %s", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.fatal("writing journal: %s", err)
+	}
+	c.changes = nil
+}
+
+// readJournal returns all journal entries, oldest first.
+func (c *command) readJournal() []journalEntry {
+	f, err := os.Open(c.journalFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		c.fatal("reading journal: %s", err)
+	}
+	defer f.Close()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			c.error("%s:%d: %s", c.journalFile(), n, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		c.fatal("reading journal: %s", err)
+	}
+	return entries
+}
+
+// linkTarget returns the target of the symlink at path, or "" if it is not a
+// symlink.
+func linkTarget(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func (c *command) log(opts *options) {
+	limit := opts.string('n', "limit")
+	json := opts.bool('j', "json")
+	c.validate(opts, anyArgs)
+	max := -1
+	if limit != "" {
+		var err error
+		if max, err = strconv.Atoi(limit); err != nil || max < 1 {
+			c.fatal("%s: %s: invalid limit", c.name, limit)
+		}
+	}
+	names := make(map[string]bool)
+	for _, name := range opts.args {
+		names[name] = true
+	}
+	entries := c.readJournal()
+	var shown []journalEntry
+	for i := len(entries) - 1; i >= 0 && len(shown) != max; i-- {
+		entry := entries[i]
+		if len(names) > 0 {
+			var changes []change
+			for _, ch := range entry.Changes {
+				if names[filepath.Base(ch.Path)] {
+					changes = append(changes, ch)
+				}
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			entry.Changes = changes
+		}
+		shown = append(shown, entry)
+	}
+	if json {
+		if shown == nil {
+			shown = []journalEntry{}
+		}
+		printJSON(shown)
+		return
+	}
+	for _, entry := range shown {
+		fmt.Printf(
+			"%s %s\n", brightBlack(entry.Time.Local().Format("2006-01-02 15:04:05")),
+			strings.Join(append([]string{"sim"}, entry.Args...), " "),
+		)
+		for _, ch := range entry.Changes {
+			line := fmt.Sprintf("    %-8s %s", ch.Action, ch.Path)
+			if ch.Target != "" {
+				line += fmt.Sprintf(" %s %s", brightBlack("->"), blue(ch.Target))
+			}
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTestJournal returns the journal entries written by sim.
+func readTestJournal(t *testing.T) []journalEntry {
+	t.Helper()
+	c := command{}
+	return c.readJournal()
+}
+
+func TestJournalRecordsChanges(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	path := filepath.Join(home, "bin", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", "--copy", src) {
+		t.Fatal("install failed")
+	}
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	entries := readTestJournal(t)
+	if len(entries) != 2 {
+		t.Fatalf("got %d journal entries, want 2", len(entries))
+	}
+	install, remove := entries[0], entries[1]
+	if want := []string{"install", "--copy", src}; !reflect.DeepEqual(install.Args, want) {
+		t.Errorf("install args = %q, want %q", install.Args, want)
+	}
+	if len(install.Changes) != 1 {
+		t.Fatalf("install changes = %+v, want one", install.Changes)
+	}
+	if ch := install.Changes[0]; ch.Action != "install" || ch.Path != path || ch.State != nil {
+		t.Errorf("install change = %+v", ch)
+	}
+	if len(remove.Changes) != 1 {
+		t.Fatalf("remove changes = %+v, want one", remove.Changes)
+	}
+	ch := remove.Changes[0]
+	if ch.Action != "remove" || ch.Path != path {
+		t.Errorf("remove change = %+v", ch)
+	}
+	if ch.Backup == "" || !exists(ch.Backup) {
+		t.Errorf("remove did not back up the copy: %+v", ch)
+	}
+	// The metadata from before the change is what lets undo restore it.
+	if ch.State == nil || ch.State.Checksum == "" {
+		t.Errorf("remove did not record the previous state: %+v", ch)
+	}
+	if remove.Time.Before(install.Time) {
+		t.Errorf("entries out of order: %s before %s", remove.Time, install.Time)
+	}
+}
+
+func TestJournalSkipsNoChanges(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	writeScript(t, src, "foo")
+	if runSim(t, "remove", "foo") {
+		t.Error("removing a missing program succeeded")
+	}
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	// Installing the same symlink again changes nothing.
+	runSim(t, "install", src)
+	if !runSim(t, "pin", "foo") {
+		t.Fatal("pin failed")
+	}
+	if entries := readTestJournal(t); len(entries) != 1 {
+		t.Errorf("got %d journal entries, want only the install: %+v", len(entries), entries)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) link(opts *options) {
+	force := opts.bool('f', "force")
+	allowMissing := opts.bool(0, "allow-missing")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 2 {
+		c.fatal("%s: expected NAME and TARGET", c.name)
+	}
+	name, target := opts.args[0], opts.args[1]
+	if !c.validName(name) {
+		return
+	}
+	var cmd installCommand
+	if _, err := os.Stat(target); err == nil {
+		var ok bool
+		if cmd, ok = newInstallCommand(c, target, false, name); !ok {
+			return
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.fatal("%s: %s", target, err)
+	} else if !allowMissing {
+		c.fatal("%s: file not found (link anyway with --allow-missing)", target)
+	} else {
+		cmd = installCommand{command: c, arg: target, name: name, absTarget: c.abs(target)}
+		cmd.path = filepath.Join(c.bin(), name)
+	}
+	if force {
+		if err := cmd.overwrite(cmd.path); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+	}
+	cmd.symlink()
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lockfile records the exact files that the entries of a manifest resolve to,
+// so that apply --locked can refuse to install anything else. Programs are
+// always installed from local files, so a lock entry is the source with all
+// symlinks resolved, plus its checksum. It is stored as JSON.
+type lockfile struct {
+	Programs []lockEntry `json:"programs"`
+}
+
+type lockEntry struct {
+	Name string `json:"name"`
+	// Source file with symlinks resolved, using "~/" like manifests.
+	Source string `json:"source"`
+	// SHA-256 of Source.
+	Checksum string `json:"checksum"`
+}
+
+// lockPath returns the lockfile path for a manifest file, which is the same
+// path with the extension replaced by ".lock".
+func lockPath(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".lock"
+}
+
+func (c *command) lock(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := opts.args[0]
+	if file == "-" {
+		c.fatal("%s: cannot lock a manifest from stdin", c.name)
+	}
+	l := lockfile{Programs: []lockEntry{}}
+	for _, e := range c.readManifest(file).Programs {
+		// Aliases refer to other programs in the manifest, which are locked,
+		// and shims have no source file.
+		if e.Original != "" || e.Mode == modeShim {
+			continue
+		}
+		source, ok := c.entrySource(e)
+		if !ok {
+			continue
+		}
+		real, sum, err := resolveSource(source)
+		if err != nil {
+			c.error("%s: %s", e.Name, err)
+			continue
+		}
+		l.Programs = append(l.Programs, lockEntry{
+			Name:     e.Name,
+			Source:   c.portablePath(real),
+			Checksum: sum,
+		})
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		c.fatal("encoding lockfile: %s", err)
+	}
+	out := lockPath(file)
+	if err := writeFileAtomic(out, append(data, '\n'), 0o644); err != nil {
+		c.fatal("%s", err)
+	}
+	fmt.Printf("Locked %d programs in %s\n", len(l.Programs), blue(out))
+}
+
+// resolveSource returns the real path of a source file and its checksum.
+func resolveSource(source string) (string, string, error) {
+	real, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := checksum(real)
+	if err != nil {
+		return "", "", err
+	}
+	return real, sum, nil
+}
+
+// readLockfile reads the lockfile for a manifest file, returning its entries
+// by name.
+func (c *command) readLockfile(file string) map[string]lockEntry {
+	path := lockPath(file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.fatal("%s (run sim lock %s)", err, file)
+	}
+	var l lockfile
+	if err := json.Unmarshal(data, &l); err != nil {
+		c.fatal("%s: invalid lockfile: %s", path, err)
+	}
+	locks := make(map[string]lockEntry)
+	for _, e := range l.Programs {
+		locks[e.Name] = e
+	}
+	return locks
+}
+
+// checkLocked returns true if a manifest entry resolves to the source and
+// checksum recorded in the lockfile. Otherwise, it reports an error.
+func (c *command) checkLocked(e manifestEntry, locks map[string]lockEntry) bool {
+	if e.Original != "" || e.Mode == modeShim {
+		return true
+	}
+	lock, ok := locks[e.Name]
+	if !ok {
+		c.error("%s: not in lockfile", e.Name)
+		return false
+	}
+	source, ok := c.entrySource(e)
+	if !ok {
+		return false
+	}
+	real, sum, err := resolveSource(source)
+	if err != nil {
+		c.error("%s: %s", e.Name, err)
+		return false
+	}
+	if want := c.localPath(lock.Source); real != want {
+		c.error("%s: source is %s, but lockfile has %s", e.Name, real, want)
+		return false
+	}
+	if sum != lock.Checksum {
+		c.error("%s: checksum of %s does not match lockfile", e.Name, real)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockPath(t *testing.T) {
+	for _, tc := range []struct{ file, want string }{
+		{"sim.json", "sim.lock"},
+		{"dir/manifest.json", "dir/manifest.lock"},
+		{"manifest", "manifest.lock"},
+		{"a.b/manifest", "a.b/manifest.lock"},
+	} {
+		if got := lockPath(tc.file); got != tc.want {
+			t.Errorf("lockPath(%q) = %q, want %q", tc.file, got, tc.want)
+		}
+	}
+}
+
+func TestApplyLocked(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	link := filepath.Join(home, "bin", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	file := exportManifest(t, home)
+	if runSim(t, "apply", "--locked", file) {
+		t.Error("apply --locked succeeded without a lockfile")
+	}
+	if !runSim(t, "lock", file) {
+		t.Fatal("lock failed")
+	}
+	if !exists(lockPath(file)) {
+		t.Fatal("lock did not write the lockfile")
+	}
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	writeScript(t, src, "changed")
+	if runSim(t, "apply", "--locked", file) {
+		t.Error("apply --locked succeeded with a changed source")
+	}
+	if exists(link) {
+		t.Error("apply --locked installed a changed source")
+	}
+	writeScript(t, src, "foo")
+	if !runSim(t, "apply", "--locked", file) {
+		t.Fatal("apply --locked failed with an unchanged source")
+	}
+	if !exists(link) {
+		t.Error("apply --locked did not install foo")
+	}
+}
+
+func TestApplyLockedMovedSource(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	file := exportManifest(t, home)
+	if !runSim(t, "lock", file) {
+		t.Fatal("lock failed")
+	}
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	// Same contents, but the manifest's source is now a symlink to another
+	// file, so it no longer resolves to the locked path.
+	moved := filepath.Join(home, "other", "foo")
+	writeScript(t, moved, "foo")
+	if err := os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(moved, src); err != nil {
+		t.Fatal(err)
+	}
+	if runSim(t, "apply", "--locked", file) {
+		t.Error("apply --locked succeeded with a source resolving elsewhere")
+	}
+	if exists(filepath.Join(home, "bin", "foo")) {
+		t.Error("apply --locked installed a source resolving elsewhere")
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+
+package main
+
+// isSymlinkLoop returns false since there is no portable error for following
+// too many symlinks. Cycles are reported like any other stat error.
+func isSymlinkLoop(err error) bool {
+	return false
+}
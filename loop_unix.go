@@ -0,0 +1,15 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isSymlinkLoop returns true if err is from following too many symlinks.
+func isSymlinkLoop(err error) bool {
+	return errors.Is(err, syscall.ELOOP)
+}
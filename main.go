@@ -3,18 +3,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
-func usage() {
-	fmt.Printf("Usage: %s [-h] COMMAND", os.Args[0])
-	fmt.Print(`
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [-h] [--version] COMMAND", os.Args[0])
+	fmt.Fprint(w, `
 
 Manage programs in $XDG_BIN_HOME
 
@@ -24,14 +32,70 @@ Commands:
     i, install  Install programs
     ls, list    List programs
     rm, remove  Remove programs
-    prune       Remove broken symlinks
+    prune       Remove broken symlinks and leftovers
     doctor      Check for issues
+    update      Update copied programs from their origins
+    outdated    List copied programs whose origins have changed
+    diff        Compare copied programs with their origins
+    freeze      Convert symlinks into copies
+    thaw        Convert copies back into symlinks
+    rename      Rename a program
+    alias       Add another name for a program
+    which       Show which file a command runs
+    info        Show details about a program
+    exec        Run a program, bypassing $PATH
+    edit        Edit a program's target
+    cat         Print a program's target
+    open        Show a program's target in the file manager
+    target      Print a program's resolved target
+    adopt       Replace copies with symlinks to their sources
+    migrate     Install programs from another directory
+    relink      Retarget symlinks after moving their sources
+    dedupe      Consolidate identical programs
+    stats       Show a summary of installed programs
+    du          Show disk usage of programs
+    grep        Search the contents of scripts
+    log         Show the history of changes
+    undo        Undo the last change
+    backup      Save programs to an archive
+    restore     Restore programs from an archive
+    bundle      Archive programs for another machine
+    pin         Protect programs from bulk removal
+    unpin       Remove protection from programs
+    disable     Take programs off $PATH temporarily
+    enable      Put disabled programs back on $PATH
+    completion  Print a shell completion script
+    man         Print manual pages
+    version     Show version information
+    selfupdate  Update sim to the latest release
+    env         Print shell commands to put sim on $PATH
+    init        Print a shell setup snippet
+    watch       Watch targets for changes
+    verify      Check programs against recorded checksums
+    switch      Choose the active version of a program
+    rollback    Switch back to the previous version
+    gc          Delete old versions and expired files
+    search      Find executables in source roots to install
+    shadow      Show other programs with the same names in $PATH
+    link        Create a symlink with a given name and target
+    sync        Keep a manifest of programs in a git repository
+    export      Write a manifest of programs
+    import      Install the programs in a manifest
+    apply       Make $XDG_BIN_HOME match a manifest
+    lock        Record the files a manifest resolves to
+    shim        Create a program that runs a command line
+    check       Test whether programs are installed and healthy
+    batch       Run sim commands read from a file
+    each        Run a command for each program
+    repair      Find the new location of broken symlink targets
+    sources     Manage the directories searched for programs
+    unused      List programs that have not been run recently
 `)
 }
 
-func usageInstall() {
-	fmt.Printf("Usage: %s install [-hfcmn] [-r NAME] PROGRAM ...", os.Args[0])
-	fmt.Print(`
+func usageInstall(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s install [-hfcmn] [-r NAME] [--resource FILE] PROGRAM ...", os.Args[0])
+	fmt.Fprint(w, `
 
 Install each PROGRAM in $XDG_BIN_HOME
 
@@ -45,55 +109,1105 @@ Options:
     -m, --move         Move instead of symlinking
     -n, --no-ext       Remove file extensions
     -r, --rename NAME  Rename single PROGRAM to NAME
+    --resource FILE    Remove FILE (e.g. a man page) along with single PROGRAM
 `)
 }
 
-func usageList() {
-	fmt.Printf("Usage: %s list [-hpldtq] [PROGRAM ...]", os.Args[0])
-	fmt.Print(`
+func usageList(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s list [-hpldtqb] [-y TYPE] [-f FMT] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
 
 List each matching PROGRAM in $XDG_BIN_HOME
 
 Arguments:
-    PROGRAM       Program name or path (for symlink, source or target)
+    PROGRAM           Program name, glob, or path (for symlink, source or target)
+                      Prefix with '!' to exclude its matches
+
+Options:
+    -h, --help        Show this help message
+    -p, --path        Print full paths to programs
+    -l, --long        Print symlink targets
+    -d, --direct      Do not match on symlink targets
+    -t, --target      Only match on symlink targets
+    -q, --quiet       Ignore patterns that match nothing
+    -b, --byte-order  Sort by bytes instead of numbers within names
+    -y, --type TYPE   Only list programs of TYPE (script or binary)
+    -f, --format FMT  Print each program using a Go template
+
+Format fields:
+    .Name             Program name
+    .Path             Full path to the program
+    .Target           Symlink target, or empty for regular files
+    .Type             "script", "binary", or empty if unknown
+    .Symlink          Whether the program is a symlink
+    .Broken           Whether the symlink target is missing
+    .AliasOf          Program with the same target, if this is an alias
+    .Pinned           Whether the program is pinned
+`)
+}
+
+func usageRemove(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s remove [-hdtqiB] [-x NAME] [-u DIR] [-b DIR | --trash] [--force-pinned] [--orphans] [--keep-resources] (-a | PROGRAM ...)", os.Args[0])
+	fmt.Fprint(w, `
+
+Remove each matching PROGRAM in $XDG_BIN_HOME. Unless --backup or --trash is
+used, regular files are kept for sim undo until sim gc deletes them
+
+Arguments:
+    PROGRAM            Program name, glob, or path (for symlink, source or target)
+                       Prefix with '!' to exclude its matches
+
+Options:
+    -h, --help         Show this help message
+    -d, --direct       Do not match on symlink targets
+    -t, --target       Only match on symlink targets
+    -q, --quiet        Ignore patterns that match nothing
+    -i, --interactive  Prompt before removing each program
+    -a, --all          Remove all programs
+    -x, --except NAME  Keep NAME (or programs matching a glob); repeatable
+    -B, --broken       Only remove broken symlinks
+    -u, --targets-under DIR
+                       Remove symlinks whose targets are in DIR
+    -b, --backup DIR   Move regular files to DIR instead of deleting
+    --trash            Move programs to the trash instead of deleting
+    --force-pinned     Remove pinned programs instead of skipping them
+    --orphans          Remove regular files with no known origin without asking
+    --keep-resources   Do not remove files installed with --resource
+
+Exit status:
+    0                  Removed or skipped all matching programs
+    1                  Invalid usage or other error
+    2                  Some PROGRAM matched nothing
+    3                  Failed to remove some programs
+`)
+}
+
+func usagePrune(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s prune [-hnij] [-u DIR] [-o DURATION] [-b DIR] [--assume-mounted DIR] [--force-pinned]", os.Args[0])
+	fmt.Fprint(w, `
+
+Remove broken symlinks in $XDG_BIN_HOME, along with leftover temporary and
+backup files and metadata for programs that no longer exist. Regular files are
+kept for sim undo until sim gc deletes them
+
+Options:
+    -h, --help         Show this help message
+    -n, --dry-run      Show what would be removed without removing it
+    -i, --interactive  Prompt before removing each symlink
+    -j, --json         Print a JSON report of what was removed
+    -u, --targets-under DIR
+                       Only remove symlinks whose targets were in DIR
+    -o, --older-than DURATION
+                       Only remove symlinks found broken at least DURATION
+                       ago (e.g. 30d) by sim prune or sim doctor --fix
+    -b, --backup DIR   Also remove backups in DIR older than 30 days
+    --assume-mounted DIR
+                       Prune targets in DIR even if it looks like an unmounted
+                       network filesystem or cannot be reached
+    --force-pinned     Prune pinned programs instead of skipping them
+`)
+}
+
+func usageDoctor(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s doctor [-hfjsc] [--quick]", os.Args[0])
+	fmt.Fprint(w, `
+
+Check for issues in $XDG_BIN_HOME
+
+Options:
+    -h, --help    Show this help message
+    -f, --fix     Fix issues where possible
+    -j, --json    Print findings as JSON
+    -s, --strict  Fail on warnings, not just errors
+    --quick       Only run fast checks (links, permissions)
+    -c, --create  Create $XDG_BIN_HOME if it does not exist
+`)
+}
+
+func usageUpdate(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s update [-hn] [NAME ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Re-copy programs installed with --copy whose origin has changed
+
+Arguments:
+    NAME           Program to update (default: all copies)
+
+Options:
+    -h, --help     Show this help message
+    -n, --dry-run  Show what would be updated without updating it
+`)
+}
+
+func usageOutdated(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s outdated [-h] [NAME ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+List programs installed with --copy whose origin has changed, showing the size
+and modification time of the installed copy and the origin
+
+Arguments:
+    NAME        Program to check (default: all copies)
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageDiff(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s diff [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Compare each program installed with --copy with its origin, showing a unified
+diff for scripts and sizes and hashes for binaries. Exits with status 1 if any
+differ
+
+Arguments:
+    NAME        Program to compare
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageFreeze(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s freeze [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Replace each symlink NAME in $XDG_BIN_HOME with a copy of its target, which is
+recorded as the origin for update
+
+Arguments:
+    NAME        Program to freeze
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageThaw(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s thaw [-hf] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Replace each program NAME installed with --copy with a symlink to its origin
+
+Arguments:
+    NAME         Program to thaw
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Thaw even if the origin's content differs
+`)
+}
+
+func usageRename(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s rename [-hf] OLD NEW", os.Args[0])
+	fmt.Fprint(w, `
+
+Rename program OLD in $XDG_BIN_HOME to NEW
+
+Arguments:
+    OLD          Current name of the program
+    NEW          New name for the program
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Overwrite NEW if it exists
+`)
+}
+
+func usageAlias(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s alias [-hf] NAME EXISTING", os.Args[0])
+	fmt.Fprint(w, `
+
+Create NAME in $XDG_BIN_HOME as an alias of program EXISTING. If EXISTING is a
+symlink, NAME points to the same target. Otherwise, NAME points to EXISTING
+
+Arguments:
+    NAME         Name of the alias
+    EXISTING     Program to create an alias of
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Overwrite NAME if it exists
+`)
+}
+
+func usageWhich(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s which [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Show which file running NAME would execute according to $PATH, and whether it
+is the program managed by sim
+
+Arguments:
+    NAME        Command to look up
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageInfo(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s info [-hj] NAME", os.Args[0])
+	fmt.Fprint(w, `
+
+Show everything known about program NAME in $XDG_BIN_HOME, including issues
+that doctor would report
+
+Arguments:
+    NAME        Program to show
+
+Options:
+    -h, --help  Show this help message
+    -j, --json  Print as JSON
+`)
+}
+
+func usageExec(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s exec [-h] NAME [-- ARG ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Run program NAME from $XDG_BIN_HOME with the given arguments, even if another
+program with the same name comes first in $PATH
+
+Arguments:
+    NAME        Program to run
+    ARG         Argument to pass to the program
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageEdit(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s edit [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Open the file each program NAME resolves to in $VISUAL or $EDITOR
+
+Arguments:
+    NAME        Program to edit
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageCat(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s cat [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Print the content of the file each program NAME resolves to. For binaries,
+print a summary and the first bytes in hexadecimal instead
+
+Arguments:
+    NAME        Program to print
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageOpen(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s open [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Reveal the file each program NAME resolves to in the file manager. On macOS
+this selects the file in Finder, and elsewhere it opens the parent directory
+with xdg-open
+
+Arguments:
+    NAME        Program to reveal
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageTarget(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s target [-h] PROGRAM ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Print the absolute path that each matching PROGRAM resolves to after following
+all symlinks. Exits with status 1 if any is missing or broken
+
+Arguments:
+    PROGRAM     Program name, glob, or path (for symlink, source or target)
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageAdopt(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s adopt [-hny] [-s DIR] [NAME ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Find regular files in $XDG_BIN_HOME that are identical to an executable in a
+source root, and replace them with symlinks to it. Source roots come from
+--source, $SIM_SOURCES (a colon-separated list of directories or globs), and
+sim sources
+
+Arguments:
+    NAME              Program to adopt (default: all regular files)
+
+Options:
+    -h, --help        Show this help message
+    -n, --dry-run     Show what would be adopted without changing anything
+    -y, --yes         Do not prompt before replacing each file
+    -s, --source DIR  Search DIR for sources (can be repeated)
+`)
+}
+
+func usageMigrate(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s migrate [-hnycm] DIR", os.Args[0])
+	fmt.Fprint(w, `
+
+Install executables from DIR (such as ~/bin) into $XDG_BIN_HOME, prompting for
+each one. Symlinks in DIR are installed as symlinks to their targets
+
+Arguments:
+    DIR            Directory to migrate from
+
+Options:
+    -h, --help     Show this help message
+    -n, --dry-run  Show what would be installed without installing it
+    -y, --yes      Do not prompt before installing each program
+    -c, --copy     Copy instead of symlinking
+    -m, --move     Move instead of symlinking
+`)
+}
+
+func usageRelink(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s relink [-hnf] OLD-PREFIX NEW-PREFIX", os.Args[0])
+	fmt.Fprint(w, `
+
+Change every symlink in $XDG_BIN_HOME whose target is in OLD-PREFIX to point to
+the same path in NEW-PREFIX instead
+
+Arguments:
+    OLD-PREFIX     Directory the targets used to be in
+    NEW-PREFIX     Directory the targets are in now
+
+Options:
+    -h, --help     Show this help message
+    -n, --dry-run  Show what would be relinked without changing anything
+    -f, --force    Relink even if the new target does not exist
+`)
+}
+
+func usageDedupe(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s dedupe [-hnyr] [--force-pinned]", os.Args[0])
+	fmt.Fprint(w, `
+
+Find programs in $XDG_BIN_HOME with identical content, and for each group keep
+one and make the rest aliases of it
+
+Options:
+    -h, --help      Show this help message
+    -n, --dry-run   Show duplicates without changing anything
+    -y, --yes       Keep the default choice without prompting
+    -r, --remove    Remove duplicates instead of making them aliases
+    --force-pinned  Replace pinned programs instead of skipping them
+`)
+}
+
+func usageStats(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s stats [-h]", os.Args[0])
+	fmt.Fprint(w, `
+
+Show counts of programs in $XDG_BIN_HOME by kind, the total size of copied
+files, the number of distinct target directories, and the latest install
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageDu(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s du [-h]", os.Args[0])
+	fmt.Fprint(w, `
+
+Show the size of each file copied into $XDG_BIN_HOME, and the total size of
+symlink targets grouped by project directory, largest first
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageGrep(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s grep [-hi] PATTERN", os.Args[0])
+	fmt.Fprint(w, `
+
+Print lines matching PATTERN in scripts that programs in $XDG_BIN_HOME resolve
+to, prefixed by the program name and line number. Exits with status 1 if no
+lines match
+
+Arguments:
+    PATTERN            Regular expression (Go RE2 syntax)
+
+Options:
+    -h, --help         Show this help message
+    -i, --ignore-case  Match case-insensitively
+`)
+}
+
+func usageLog(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s log [-hj] [-n N] [NAME ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Show commands that changed $XDG_BIN_HOME, newest first, along with the files
+they changed
+
+Arguments:
+    NAME             Only show changes to these programs
+
+Options:
+    -h, --help       Show this help message
+    -j, --json       Print as JSON
+    -n, --limit N    Only show the last N commands
+`)
+}
+
+func usageUndo(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s undo [-hfn]", os.Args[0])
+	fmt.Fprint(w, `
+
+Undo the last command shown by sim log. Running it again undoes the command
+before that, unless some changes could not be undone, in which case it retries
+them. Only install, remove, prune, restore, and switch can be undone
+
+Options:
+    -h, --help     Show this help message
+    -f, --force    Undo even if programs changed since
+    -n, --dry-run  Show what would be undone without changing anything
+`)
+}
+
+func usageBackup(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s backup [-hf] [FILE]", os.Args[0])
+	fmt.Fprint(w, `
+
+Save all programs in $XDG_BIN_HOME and their metadata to a .tar.gz archive
+
+Arguments:
+    FILE         Archive to create (default: sim-backup-TIME.tar.gz)
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Overwrite FILE if it exists
+`)
+}
+
+func usageRestore(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s restore [-hfn] FILE", os.Args[0])
+	fmt.Fprint(w, `
+
+Restore programs and their metadata from an archive created by sim backup.
+Programs not in the archive are left alone
+
+Arguments:
+    FILE           Archive to restore from
+
+Options:
+    -h, --help     Show this help message
+    -f, --force    Overwrite programs that differ from the archive
+    -n, --dry-run  Show what would be restored without changing anything
+`)
+}
+
+func usageBundle(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s bundle [-hf] [FILE]", os.Args[0])
+	fmt.Fprint(w, `
+
+Create a .tar.gz archive of all programs in $XDG_BIN_HOME, with symlinks
+replaced by the files they point to. Extract it into the bin directory on
+another machine to use the programs there
+
+Arguments:
+    FILE         Archive to create (default: sim-bundle-TIME.tar.gz)
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Overwrite FILE if it exists
+`)
+}
+
+func usagePin(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s pin [-h] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Protect programs from bulk removal. Pinned programs are skipped by remove,
+prune, and dedupe unless they are given --force-pinned. With no arguments,
+list pinned programs
+
+Arguments:
+    PROGRAM     Name of program to pin
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageUnpin(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s unpin [-h] PROGRAM ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Remove the protection added by sim pin
+
+Arguments:
+    PROGRAM     Name of program to unpin
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageDisable(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s disable [-h] PROGRAM ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Take programs off $PATH without removing them, by moving them into
+$XDG_BIN_HOME/.disabled
+
+Arguments:
+    PROGRAM     Name of program to disable
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageEnable(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s enable [-h] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Put programs disabled by sim disable back on $PATH. With no arguments, list
+disabled programs
+
+Arguments:
+    PROGRAM     Name of program to enable
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageCompletion(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s completion [-h] SHELL", os.Args[0])
+	fmt.Fprint(w, `
+
+Print a script that completes sim commands and flags. For example, add
+"source <(sim completion bash)" to ~/.bashrc
+
+Arguments:
+    SHELL       Shell to complete in (bash, zsh, or fish)
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageMan(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s man [-h] [-o DIR] [COMMAND]", os.Args[0])
+	fmt.Fprint(w, `
+
+Print the manual page for sim or one of its commands in roff format, or write
+all of them to a directory
+
+Arguments:
+    COMMAND           Command to print the manual page for
+
+Options:
+    -h, --help        Show this help message
+    -o, --output DIR  Write sim.1, sim-install.1, etc. to DIR
+`)
+}
+
+func usageVersion(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s version [-hs]", os.Args[0])
+	fmt.Fprint(w, `
+
+Show the version of sim and how it was built. Include this when reporting bugs
+
+Options:
+    -h, --help   Show this help message
+    -s, --short  Only print the version number
+`)
+}
+
+func usageSelfupdate(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s selfupdate [-hcf]", os.Args[0])
+	fmt.Fprint(w, `
+
+Replace the running sim executable with the latest release for this platform,
+after verifying its checksum
+
+Options:
+    -h, --help   Show this help message
+    -c, --check  Only check whether an update is available
+    -f, --force  Update even if this version is current or a development build
+`)
+}
+
+func usageEnv(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s env [-h] [-s SHELL]", os.Args[0])
+	fmt.Fprint(w, `
+
+Print commands that add $XDG_BIN_HOME to $PATH and export the XDG variables sim
+uses, for evaluating in a shell startup file. For example, add this to .bashrc:
+
+    eval "$(sim env)"
+
+Or this to config.fish:
+
+    sim env | source
+
+This command is also available as sim shellenv
+
+Options:
+    -h, --help         Show this help message
+    -s, --shell SHELL  Shell syntax: sh, bash, zsh, or fish (default: $SHELL)
+`)
+}
+
+func usageInit(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s init [-hpt] [--no-completion] SHELL", os.Args[0])
+	fmt.Fprint(w, `
+
+Print a snippet that sets up SHELL to use sim: it adds $XDG_BIN_HOME to $PATH
+(like sim env) and loads completions (like sim completion). For example, add
+this to .zshrc after compinit:
+
+    eval "$(sim init zsh)"
+
+Or this to config.fish:
+
+    sim init fish | source
+
+Arguments:
+    SHELL  One of bash, zsh, or fish
+
+Options:
+    -h, --help       Show this help message
+    -p, --prompt     Warn about broken symlinks before the prompt
+    -t, --track      Record when programs are run, for sim unused
+    --no-completion  Do not load completions
+`)
+}
+
+func usageWatch(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s watch [-hr] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Watch the targets of symlinks and the origins of copies in $XDG_BIN_HOME, and
+report when they are removed, created, rebuilt, or change mode. Runs until
+interrupted
+
+Arguments:
+    PROGRAM  Program to watch (default: all)
 
 Options:
     -h, --help    Show this help message
-    -p, --path    Print full paths to programs
-    -l, --long    Print symlink targets
-    -d, --direct  Do not match on symlink targets
-    -t, --target  Only match on symlink targets
-    -q, --quiet   Ignore patterns that match nothing
+    -r, --repair  Update copies when their origins change, and make targets
+                  executable again when they lose permission
+`)
+}
+
+func usageVerify(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s verify [-hlj] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Recompute the checksums of copied and moved programs and compare them with the
+values recorded when they were installed. Exits with status 1 if any program
+was modified or is missing
+
+Arguments:
+    PROGRAM  Program to verify (default: all)
+
+Options:
+    -h, --help   Show this help message
+    -l, --links  Also verify the targets of symlinks
+    -j, --json   Print results as JSON
+`)
+}
+
+func usageSwitch(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s switch [-hf] NAME [VERSION]", os.Args[0])
+	fmt.Fprint(w, `
+
+Make NAME a symlink to NAME-VERSION in $XDG_BIN_HOME. For example, after
+installing go-1.21.0 and go-1.22.1, run sim switch go 1.22.1 to make go run
+go-1.22.1. Without VERSION, list the installed versions of NAME
+
+Arguments:
+    NAME     Unversioned program name
+    VERSION  Version to switch to
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Replace NAME even if it is not a symlink to a version
+`)
+}
+
+func usageRollback(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s rollback [-h] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Switch each NAME back to the version that was active before the last sim
+switch. Rolling back twice returns to the version you started with
+
+Arguments:
+    NAME  Unversioned program name
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageGc(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s gc [-hn] [-k N] [-b DIR]", os.Args[0])
+	fmt.Fprint(w, `
+
+Delete inactive versions of programs managed with sim switch, files kept for sim
+undo that are over 30 days old, and leftover downloads from sim selfupdate.
+Unlike sim remove, this deletes files permanently
+
+Options:
+    -h, --help        Show this help message
+    -n, --dry-run     Show what would be deleted without deleting anything
+    -k, --keep N      Number of inactive versions to keep (default: 2)
+    -b, --backup DIR  Also delete backups in DIR over 30 days old
+`)
+}
+
+func usageSearch(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s search [-hiy] [-s DIR] [PATTERN]", os.Args[0])
+	fmt.Fprint(w, `
+
+List executables in source roots that are not installed in $XDG_BIN_HOME. Source
+roots come from --source, $SIM_SOURCES (a colon-separated list of directories
+or globs such as ~/src/*/bin:~/go/bin), and sim sources
+
+Arguments:
+    PATTERN           Only show names containing PATTERN, or matching it if it is
+                      a glob
+
+Options:
+    -h, --help        Show this help message
+    -i, --install     Offer to install each executable found
+    -y, --yes         Do not prompt before installing with --install
+    -s, --source DIR  Search DIR for executables (can be repeated)
+`)
+}
+
+func usageShadow(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s shadow [-haj] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+For each program in $XDG_BIN_HOME, list every executable with the same name in
+$PATH and show which one runs. By default, only programs with conflicts are
+shown
+
+Arguments:
+    PROGRAM     Program to check (implies --all)
+
+Options:
+    -h, --help  Show this help message
+    -a, --all   Show programs without conflicts too
+    -j, --json  Print results as JSON
+`)
+}
+
+func usageLink(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s link [-hf] [--allow-missing] NAME TARGET", os.Args[0])
+	fmt.Fprint(w, `
+
+Create a symlink called NAME in $XDG_BIN_HOME pointing to TARGET. With
+--allow-missing, TARGET does not have to exist yet, so you can set up a link
+before building its target for the first time. Until then, sim prune considers
+the link broken, so pin it with sim pin to keep it
+
+Arguments:
+    NAME             Program name
+    TARGET           Path to an executable
+
+Options:
+    -h, --help       Show this help message
+    -f, --force      Overwrite NAME if it exists
+    --allow-missing  Create the symlink even if TARGET does not exist
+`)
+}
+
+func usageSync(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s sync [-hp] [-f FILE] [-m MESSAGE]", os.Args[0])
+	fmt.Fprint(w, `
+
+Write a manifest of the programs in $XDG_BIN_HOME to FILE, which must be in a
+git repository such as your dotfiles, and commit it if it changed. With --pull,
+first pull the repository and install programs from the manifest that are
+missing, so that running sim sync --pull on each machine keeps them consistent
+
+The manifest lists symlinks, copies with known origins, and aliases. Paths
+under your home directory are written relative to ~
+
+Options:
+    -h, --help             Show this help message
+    -p, --pull             Pull and install missing programs first
+    -f, --file FILE        Manifest file (default: $SIM_MANIFEST)
+    -m, --message MESSAGE  Commit message
+`)
+}
+
+func usageExport(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s export [-h] [FILE]", os.Args[0])
+	fmt.Fprint(w, `
+
+Write a JSON manifest of the programs in $XDG_BIN_HOME to FILE, or to stdout if
+FILE is omitted or -. It records each program's name, install mode, symlink
+target or origin, checksum, and whether it is pinned. Moved programs and other
+files without a known source are left out, since they cannot be installed again
+
+Arguments:
+    FILE        Manifest file to write
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageImport(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s import [-h] FILE", os.Args[0])
+	fmt.Fprint(w, `
+
+Install the programs described by a manifest written by sim export, reading it
+from stdin if FILE is -. Programs that are already installed as described are
+skipped. Entries whose source is missing, and names taken by a different
+program, are reported as errors
+
+Arguments:
+    FILE        Manifest file to read
+
+Options:
+    -h, --help  Show this help message
 `)
 }
 
-func usageRemove() {
-	fmt.Printf("Usage: %s remove [-hdtq] PROGRAM ...", os.Args[0])
-	fmt.Print(`
+func usageApply(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s apply [-hnp] [--force-pinned] [--locked] FILE", os.Args[0])
+	fmt.Fprint(w, `
 
-Remove each matching PROGRAM in $XDG_BIN_HOME
+Make $XDG_BIN_HOME match a manifest written by sim export, reading it from stdin
+if FILE is -. Missing programs are installed, programs with the wrong target or
+origin are replaced, and pins are updated to match. With --prune, programs that
+sim could export but that are not in the manifest are removed. Running it again
+does nothing. Pinned programs are not replaced, removed, or unpinned unless
+--force-pinned is given. With --locked, programs are only installed if their sources match the
+lockfile written by sim lock
 
 Arguments:
-    PROGRAM       Program name or path (for symlink, source or target)
+    FILE            Manifest file to read
 
 Options:
-    -h, --help    Show this help message
-    -d, --direct  Do not match on symlink targets
-    -t, --target  Only match on symlink targets
-    -q, --quiet   Ignore patterns that match nothing
+    -h, --help      Show this help message
+    -n, --dry-run   Print what would happen without doing it
+    -p, --prune     Remove programs not in the manifest
+    --force-pinned  Replace, remove, or unpin pinned programs
+    --locked        Require sources to match the lockfile
+`)
+}
+
+func usageLock(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s lock [-h] FILE", os.Args[0])
+	fmt.Fprint(w, `
+
+Write a lockfile for a manifest written by sim export. For each program, it
+records the source file with symlinks resolved and its SHA-256 checksum. The
+lockfile is written next to FILE with the extension replaced by .lock, and is
+used by sim apply --locked to install exactly the same files on another machine
+
+Arguments:
+    FILE        Manifest file to lock
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageShim(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s shim [-hf] NAME -- COMMAND [ARG ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Create a shell script NAME in $XDG_BIN_HOME that execs COMMAND with the given
+arguments, followed by any arguments passed to NAME. For example:
+
+    sim shim k -- kubectl --context prod
+
+Shims are managed like other programs. The command line is recorded so that sim
+export includes it, and sim doctor reports shims whose command cannot be found
+
+Arguments:
+    NAME         Name of the shim
+    COMMAND      Command to run
+    ARG          Arguments to pass before the shim's own
+
+Options:
+    -h, --help   Show this help message
+    -f, --force  Overwrite NAME if it exists
+`)
+}
+
+func usageCheck(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s check [-hv] NAME ...", os.Args[0])
+	fmt.Fprint(w, `
+
+Exit silently with status 0 if every NAME is installed in $XDG_BIN_HOME and can
+be run, for use in scripts. For example:
+
+    sim check rg || sim install ~/src/ripgrep/target/release/rg
+
+The exit status is 1 if a program is not installed, and 2 if it is installed
+but broken: a broken symlink, not executable, or a shim whose command cannot be
+found. With several programs, it is the status of the first one that fails
+
+Arguments:
+    NAME           Program name
+
+Options:
+    -h, --help     Show this help message
+    -v, --verbose  Explain why a program failed the check
+`)
+}
+
+func usageBatch(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s batch [-hev] [FILE]", os.Args[0])
+	fmt.Fprint(w, `
+
+Run sim commands from FILE, or from stdin if FILE is omitted or -, one per line
+without the leading "sim". This is much faster than running sim for each one,
+since state is loaded and saved once. Lines are split into words like in a
+shell, with quotes, backslashes, and ~ for the home directory, but no other
+expansions. A '#' starts a comment. For example:
+
+    sim batch <<EOF
+    install ~/src/tool/bin/tool
+    shim k -- kubectl --context prod
+    pin tool
+    EOF
+
+Each line is recorded separately for sim undo. Failed lines are reported by
+number, and sim batch exits with status 1 if any failed. The exec and watch
+commands cannot be used in a batch
+
+Arguments:
+    FILE           File of commands to run
+
+Options:
+    -h, --help     Show this help message
+    -e, --errexit  Stop after the first line that fails
+    -v, --verbose  Print each command before running it
+`)
+}
+
+func usageEach(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s each [-hnev] [-m PATTERN] -- COMMAND [ARG ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Run COMMAND once for each program in $XDG_BIN_HOME, in order. In COMMAND and its
+arguments, {} is replaced by the program name, {path} by its path, and {target}
+by the file it resolves to after following symlinks. If none of these appear,
+the name is passed as the last argument. For example:
+
+    sim each -- file {target}
+
+Programs whose target cannot be resolved are reported as errors and skipped. The
+command runs without a shell, so use sh -c to get pipes and redirections
+
+Arguments:
+    COMMAND              Command to run
+    ARG                  Arguments to pass
+
+Options:
+    -h, --help           Show this help message
+    -n, --dry-run        Print the commands without running them
+    -e, --errexit        Stop after the first command that fails
+    -v, --verbose        Print each command before running it
+    -m, --match PATTERN  Only include programs matching glob PATTERN
+`)
+}
+
+func usageRepair(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s repair [-hny] [-s DIR] [PROGRAM ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Repair broken symlinks in $XDG_BIN_HOME, or only the given PROGRAMs, by looking
+for a file with the same name as the old target in the source roots (see sim
+search). Files with the same checksum as when the program was installed are
+listed first. This fixes programs whose repository was moved or renamed without
+reinstalling them. With --yes, a program is only repaired if there is a single
+file to choose, or a single one with the same checksum
+
+Arguments:
+    PROGRAM           Program to repair
+
+Options:
+    -h, --help        Show this help message
+    -n, --dry-run     Show what would be repaired without doing it
+    -y, --yes         Repair without prompting
+    -s, --source DIR  Search DIR for targets (can be repeated)
+`)
+}
+
+func usageSources(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s sources [-h] [list | add DIR ... | remove DIR ...]", os.Args[0])
+	fmt.Fprint(w, `
+
+Manage the source roots that sim search, sim adopt, and sim repair look in for
+executables. They are stored one per line in $XDG_CONFIG_HOME/sim/sources, and
+are searched after any given by --source or $SIM_SOURCES. A source root can be a
+glob such as ~/src/*/bin
+
+Commands:
+    list        List source roots (the default)
+    add         Add source roots
+    remove      Remove source roots
+
+Arguments:
+    DIR         Directory or glob
+
+Options:
+    -h, --help  Show this help message
+`)
+}
+
+func usageUnused(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s unused [-hj] [-s DURATION]", os.Args[0])
+	fmt.Fprint(w, `
+
+List programs in $XDG_BIN_HOME that have not been run recently, least recently
+used first, to help decide what to remove. Runs are only recorded by sim exec
+and by shells set up with sim init --track, so enable tracking and wait for the
+period to pass before trusting the result. Programs with no recorded runs are
+listed as unknown. Programs installed within the period are left out.
+
+Options:
+    -h, --help            Show this help message
+    -j, --json            Print a JSON array of programs
+    -s, --since DURATION  List programs not used in DURATION (default: 90d)
 `)
 }
 
 func main() {
-	opts := parseOptions(os.Args[1:])
-	cmd := command{name: "help"}
-	if !opts.bool('h', "help") {
-		if arg, ok := opts.shift(); ok {
-			cmd.name = arg
-		}
-	}
-	cmd.dispatch(opts)
+	cmd := command{args: os.Args[1:]}
+	cmd.run(parseOptions(cmd.args))
+	cmd.saveState()
+	cmd.saveJournal()
 	if cmd.failed {
+		if cmd.exitCode != 0 {
+			os.Exit(cmd.exitCode)
+		}
 		os.Exit(1)
 	}
 }
@@ -103,6 +1217,56 @@ type command struct {
 	failed  bool
 	homeDir string
 	binDir  string
+	// Command line arguments, excluding the program name.
+	args []string
+	// Exit code to use instead of 1 when failed is true.
+	exitCode int
+	// Lazily loaded state, and whether it needs to be saved.
+	st         *state
+	stateDirty bool
+	// Changes to record in the journal.
+	changes []change
+	// Time of the journal entry undone by this command, if any.
+	undid *time.Time
+	// Indexes of changes in that entry that could not be undone.
+	undoFailed []int
+	// Whether this is running a line of sim batch.
+	batch bool
+	// Whether abort is saving changes, to avoid recursing if that fails.
+	aborting bool
+	// Cached listing of the bin directory, for sim batch. It is cleared
+	// whenever a change is made.
+	dir []fs.DirEntry
+}
+
+// run determines the command name from opts and dispatches it.
+func (c *command) run(opts *options) {
+	c.name = "help"
+	if versionBeforeCommand(c.args) && opts.bool(0, "version") {
+		c.name = "version"
+	} else if !opts.bool('h', "help") {
+		if arg, ok := opts.shift(); ok {
+			c.name = arg
+		}
+	}
+	if c.batch && batchUnsupported[c.name] {
+		c.fatal("%s: not supported in sim batch", c.name)
+	}
+	c.dispatch(opts)
+}
+
+// versionBeforeCommand returns true if args has --version before the command
+// name, as in "sim --version". After the command, it is just an unknown flag.
+func versionBeforeCommand(args []string) bool {
+	for _, arg := range args {
+		if arg == "--version" {
+			return true
+		}
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return false
 }
 
 func (c *command) dispatch(opts *options) {
@@ -121,6 +1285,120 @@ func (c *command) dispatch(opts *options) {
 		c.prune(opts)
 	case "doctor":
 		c.doctor(opts)
+	case "update":
+		c.update(opts)
+	case "outdated":
+		c.outdated(opts)
+	case "diff":
+		c.diff(opts)
+	case "freeze":
+		c.freeze(opts)
+	case "thaw":
+		c.thaw(opts)
+	case "rename":
+		c.rename(opts)
+	case "alias":
+		c.alias(opts)
+	case "which":
+		c.which(opts)
+	case "info":
+		c.info(opts)
+	case "exec":
+		c.exec(opts)
+	case "edit":
+		c.edit(opts)
+	case "cat":
+		c.cat(opts)
+	case "open":
+		c.open(opts)
+	case "target":
+		c.target(opts)
+	case "adopt":
+		c.adopt(opts)
+	case "migrate":
+		c.migrate(opts)
+	case "relink":
+		c.relink(opts)
+	case "dedupe":
+		c.dedupe(opts)
+	case "stats":
+		c.stats(opts)
+	case "du":
+		c.du(opts)
+	case "grep":
+		c.grep(opts)
+	case "log":
+		c.log(opts)
+	case "undo":
+		c.undo(opts)
+	case "backup":
+		c.backup(opts)
+	case "restore":
+		c.restore(opts)
+	case "bundle":
+		c.bundle(opts)
+	case "pin":
+		c.pin(opts)
+	case "unpin":
+		c.unpin(opts)
+	case "disable":
+		c.disable(opts)
+	case "enable":
+		c.enable(opts)
+	case "completion":
+		c.completion(opts)
+	case "__complete":
+		c.complete(opts)
+	case "man":
+		c.man(opts)
+	case "version":
+		c.version(opts)
+	case "selfupdate":
+		c.selfupdate(opts)
+	case "env", "shellenv":
+		c.env(opts)
+	case "init":
+		c.init(opts)
+	case "watch":
+		c.watch(opts)
+	case "verify":
+		c.verify(opts)
+	case "switch":
+		c.switchVersion(opts)
+	case "rollback":
+		c.rollback(opts)
+	case "gc":
+		c.gc(opts)
+	case "search":
+		c.search(opts)
+	case "shadow":
+		c.shadow(opts)
+	case "link":
+		c.link(opts)
+	case "sync":
+		c.sync(opts)
+	case "export":
+		c.export(opts)
+	case "import":
+		c.importManifest(opts)
+	case "apply":
+		c.apply(opts)
+	case "lock":
+		c.lock(opts)
+	case "shim":
+		c.shim(opts)
+	case "check":
+		c.check(opts)
+	case "batch":
+		c.runBatch(opts)
+	case "each":
+		c.each(opts)
+	case "repair":
+		c.repair(opts)
+	case "sources":
+		c.sources(opts)
+	case "unused":
+		c.unused(opts)
 	case "":
 		c.fatal("missing command")
 	default:
@@ -131,18 +1409,142 @@ func (c *command) dispatch(opts *options) {
 func (c *command) help(opts *options) {
 	c.validate(opts, anyArgs)
 	name := opts.tryShift()
+	printUsage, ok := usageFor(name)
+	if !ok {
+		c.fatal("%s: unrecognized command", name)
+	}
+	printUsage(os.Stdout)
+}
+
+// usageFor returns the function that prints help for a command.
+func usageFor(name string) (func(io.Writer), bool) {
 	switch name {
-	case "", "help", "path", "prune", "doctor":
-		usage()
+	case "", "help", "path":
+		return usage, true
+	case "doctor":
+		return usageDoctor, true
+	case "update":
+		return usageUpdate, true
+	case "outdated":
+		return usageOutdated, true
+	case "diff":
+		return usageDiff, true
+	case "freeze":
+		return usageFreeze, true
+	case "thaw":
+		return usageThaw, true
+	case "rename":
+		return usageRename, true
+	case "alias":
+		return usageAlias, true
+	case "which":
+		return usageWhich, true
+	case "info":
+		return usageInfo, true
+	case "exec":
+		return usageExec, true
+	case "edit":
+		return usageEdit, true
+	case "cat":
+		return usageCat, true
+	case "open":
+		return usageOpen, true
+	case "target":
+		return usageTarget, true
+	case "adopt":
+		return usageAdopt, true
+	case "migrate":
+		return usageMigrate, true
+	case "relink":
+		return usageRelink, true
+	case "dedupe":
+		return usageDedupe, true
+	case "stats":
+		return usageStats, true
+	case "du":
+		return usageDu, true
+	case "grep":
+		return usageGrep, true
+	case "log":
+		return usageLog, true
+	case "undo":
+		return usageUndo, true
+	case "backup":
+		return usageBackup, true
+	case "restore":
+		return usageRestore, true
+	case "bundle":
+		return usageBundle, true
+	case "pin":
+		return usagePin, true
+	case "unpin":
+		return usageUnpin, true
+	case "disable":
+		return usageDisable, true
+	case "enable":
+		return usageEnable, true
+	case "completion":
+		return usageCompletion, true
+	case "man":
+		return usageMan, true
+	case "version":
+		return usageVersion, true
+	case "selfupdate":
+		return usageSelfupdate, true
+	case "env", "shellenv":
+		return usageEnv, true
+	case "init":
+		return usageInit, true
+	case "watch":
+		return usageWatch, true
+	case "verify":
+		return usageVerify, true
+	case "switch":
+		return usageSwitch, true
+	case "rollback":
+		return usageRollback, true
+	case "gc":
+		return usageGc, true
+	case "search":
+		return usageSearch, true
+	case "shadow":
+		return usageShadow, true
+	case "link":
+		return usageLink, true
+	case "sync":
+		return usageSync, true
+	case "export":
+		return usageExport, true
+	case "import":
+		return usageImport, true
+	case "apply":
+		return usageApply, true
+	case "lock":
+		return usageLock, true
+	case "shim":
+		return usageShim, true
+	case "check":
+		return usageCheck, true
+	case "batch":
+		return usageBatch, true
+	case "each":
+		return usageEach, true
+	case "repair":
+		return usageRepair, true
+	case "sources":
+		return usageSources, true
+	case "unused":
+		return usageUnused, true
+	case "prune":
+		return usagePrune, true
 	case "i", "install":
-		usageInstall()
+		return usageInstall, true
 	case "ls", "list":
-		usageList()
+		return usageList, true
 	case "rm", "remove":
-		usageRemove()
-	default:
-		c.fatal("%s: unrecognized command", name)
+		return usageRemove, true
 	}
+	return nil, false
 }
 
 func (c *command) path(opts *options) {
@@ -156,6 +1558,7 @@ func (c *command) install(opts *options) {
 	move := opts.bool('m', "move")
 	noExt := opts.bool('n', "no-ext")
 	rename := opts.string('r', "rename")
+	resources := opts.strings(0, "resource")
 	c.validate(opts, atLeastOneArg)
 	if copy && move {
 		c.fatal("%s: cannot use --copy and --move together", c.name)
@@ -166,13 +1569,26 @@ func (c *command) install(opts *options) {
 	if rename != "" && len(opts.args) != 1 {
 		c.fatal("%s: --rename requires a single program", c.name)
 	}
+	if len(resources) > 0 && len(opts.args) != 1 {
+		c.fatal("%s: --resource requires a single program", c.name)
+	}
+	for i, resource := range resources {
+		if _, err := os.Stat(resource); err != nil {
+			c.fatal("%s: %s", resource, err)
+		}
+		resources[i] = c.abs(resource)
+	}
 	for _, arg := range opts.args {
 		cmd, ok := newInstallCommand(c, arg, noExt, rename)
 		if !ok {
 			continue
 		}
+		cmd.resources = resources
 		if force {
-			os.Remove(cmd.path)
+			if err := cmd.overwrite(cmd.path); err != nil {
+				c.error("%s: %s", cmd.name, err)
+				continue
+			}
 		}
 		if copy {
 			cmd.copy()
@@ -188,6 +1604,8 @@ type installCommand struct {
 	*command
 	arg, name, path, absTarget string
 	targetStat                 fs.FileInfo
+	// Absolute paths of associated files to remove along with the program.
+	resources []string
 }
 
 func newInstallCommand(cmd *command, arg string, noExt bool, rename string) (installCommand, bool) {
@@ -203,6 +1621,8 @@ func newInstallCommand(cmd *command, arg string, noExt bool, rename string) (ins
 		c.error("%s: program must not start with '.'", arg)
 	} else if !isExecutable(c.targetStat.Mode()) {
 		c.error("%s: not an executable", arg)
+	} else if !canExecute(arg) {
+		c.error("%s: not executable by current user", arg)
 	} else if c.absTarget, err = filepath.Abs(arg); err != nil {
 		c.error("%s: %s", arg, err)
 	} else {
@@ -231,6 +1651,7 @@ func (c *installCommand) copy() {
 	if err == nil {
 		if c.sameFileContent(info) {
 			fmt.Printf(" %s\n", brightBlack("(already installed)"))
+			c.save(modeCopy, c.absTarget)
 		} else {
 			fmt.Println()
 			c.error("%s: %s exists (overwrite with --force)", c.arg, c.name)
@@ -240,7 +1661,9 @@ func (c *installCommand) copy() {
 	fmt.Println()
 	if err := exec.Command("cp", c.absTarget, c.path).Run(); err != nil {
 		c.error("%s: copying file: %s", c.arg, err)
+		return
 	}
+	c.record(modeCopy, c.absTarget)
 }
 
 func (c *installCommand) move() {
@@ -273,7 +1696,9 @@ func (c *installCommand) move() {
 	}
 	if err := os.Rename(c.absTarget, c.path); err != nil {
 		c.error("%s: moving file: %s", c.arg, err)
+		return
 	}
+	c.record(modeMove, "")
 }
 
 func (c *installCommand) symlink() {
@@ -286,6 +1711,7 @@ func (c *installCommand) symlink() {
 	err = os.Symlink(relTarget, c.path)
 	if err == nil {
 		fmt.Println()
+		c.record(modeSymlink, "")
 		return
 	}
 	if !errors.Is(err, os.ErrExist) {
@@ -308,6 +1734,7 @@ func (c *installCommand) symlink() {
 		}
 		if relTarget == existing {
 			fmt.Printf(" %s\n", brightBlack("(already installed)"))
+			c.save(modeSymlink, "")
 			return
 		}
 	}
@@ -315,6 +1742,35 @@ func (c *installCommand) symlink() {
 	c.error("%s: %s exists (overwrite with --force)", c.arg, c.name)
 }
 
+// record logs the installation in the journal and saves metadata.
+func (c *installCommand) record(mode, origin string) {
+	c.logChange("install", c.path, c.absTarget)
+	c.save(mode, origin)
+}
+
+// save saves metadata about the installed program, keeping its pin.
+func (c *installCommand) save(mode, origin string) {
+	p := c.state().program(c.name)
+	*p = programState{
+		Pinned:    p.Pinned,
+		Mode:      mode,
+		Origin:    origin,
+		Installed: stamp(),
+		Resources: c.resources,
+	}
+	if mode == modeSymlink {
+		// The target might not exist yet (see sim link --allow-missing).
+		p.TargetChecksum, _ = checksum(c.path)
+	} else {
+		sum, err := checksum(c.path)
+		if err != nil {
+			c.error("%s: %s", c.arg, err)
+		}
+		p.Checksum = sum
+	}
+	c.modified()
+}
+
 func (c *installCommand) sameFileContent(existingInfo fs.FileInfo) bool {
 	if existingInfo.Size() != c.targetStat.Size() {
 		return false
@@ -340,17 +1796,36 @@ func (c *command) list(opts *options) {
 	cmd.directOnly = opts.bool('d', "direct")
 	cmd.targetOnly = opts.bool('t', "target")
 	cmd.ignoreNoMatch = opts.bool('q', "quiet")
+	byteOrder := opts.bool('b', "byte-order")
+	cmd.typeFilter = opts.string('y', "type")
+	format := opts.string('f', "format")
 	cmd.validate(opts, anyArgs)
+	patterns := cmd.exclude(opts.args)
 	if cmd.directOnly && cmd.targetOnly {
 		cmd.fatal("%s: cannot use --direct and --target together", cmd.name)
 	}
-	if len(opts.args) > 0 {
-		cmd.perform(cmd.listProgram, opts.args)
-		return
+	switch cmd.typeFilter {
+	case "", typeScript, typeBinary:
+	default:
+		cmd.fatal("%s: %s: invalid type (expected %s or %s)", cmd.name, cmd.typeFilter, typeScript, typeBinary)
+	}
+	if format != "" {
+		if cmd.showPath || cmd.showTarget {
+			cmd.fatal("%s: cannot use --format with --path or --long", cmd.name)
+		}
+		var err error
+		if cmd.format, err = template.New("format").Parse(unescape(format)); err != nil {
+			cmd.fatal("%s: --format: %s", cmd.name, err)
+		}
+	}
+	if byteOrder {
+		cmd.sort(func(a, b string) bool { return a < b })
 	}
-	for _, name := range cmd.names {
-		cmd.listProgram(match{name, cmd.nameToAbsTarget[name]})
+	if len(patterns) > 0 {
+		cmd.perform(cmd.listProgram, patterns)
+		return
 	}
+	cmd.performAll(cmd.listProgram)
 }
 
 func (c *command) remove(opts *options) {
@@ -359,13 +1834,84 @@ func (c *command) remove(opts *options) {
 	cmd.directOnly = opts.bool('d', "direct")
 	cmd.targetOnly = opts.bool('t', "target")
 	cmd.ignoreNoMatch = opts.bool('q', "quiet")
-	cmd.validate(opts, atLeastOneArg)
-	cmd.perform(cmd.removeProgram, opts.args)
+	cmd.interactive = opts.bool('i', "interactive")
+	cmd.useTrash = opts.bool(0, "trash")
+	cmd.brokenOnly = opts.bool('B', "broken")
+	cmd.forcePinned = opts.bool(0, "force-pinned")
+	cmd.orphans = opts.bool(0, "orphans")
+	cmd.keepResources = opts.bool(0, "keep-resources")
+	all := opts.bool('a', "all")
+	cmd.except = opts.strings('x', "except")
+	backupDir := opts.string('b', "backup")
+	targetsUnder := opts.string('u', "targets-under")
+	validation := atLeastOneArg
+	if all || targetsUnder != "" || cmd.brokenOnly {
+		validation = anyArgs
+	}
+	cmd.validate(opts, validation)
+	patterns := cmd.exclude(opts.args)
+	if all && len(patterns) > 0 {
+		cmd.fatal("%s: %s: unexpected argument with --all", cmd.name, patterns[0])
+	}
+	if validation == atLeastOneArg && len(patterns) == 0 {
+		cmd.fatal("%s: expected at least one pattern that is not negated", cmd.name)
+	}
+	for _, pattern := range cmd.except {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			cmd.fatal("%s: --except %s: %s", cmd.name, pattern, err)
+		}
+	}
+	if cmd.useTrash && backupDir != "" {
+		cmd.fatal("%s: cannot use --trash and --backup together", cmd.name)
+	}
+	if backupDir != "" {
+		cmd.backupDir = cmd.abs(backupDir)
+	}
+	if targetsUnder != "" {
+		cmd.targetsUnder = cmd.abs(targetsUnder)
+	}
+	if len(patterns) == 0 {
+		cmd.performAll(cmd.removeProgram)
+	} else {
+		cmd.perform(cmd.removeProgram, patterns)
+	}
+	if len(patterns) > 1 || cmd.removed+cmd.skipped+cmd.errored > 1 {
+		fmt.Printf("Removed %d, skipped %d, failed %d\n", cmd.removed, cmd.skipped, cmd.errored)
+	}
+	if cmd.errored > 0 {
+		cmd.exitCode = exitRemoveFailed
+	} else if cmd.unmatched > 0 {
+		cmd.exitCode = exitNoMatch
+	}
 }
 
+// Exit codes for remove.
+const (
+	exitNoMatch      = 2
+	exitRemoveFailed = 3
+)
+
 type lsRmCommand struct {
 	*command
 	showPath, showTarget, directOnly, targetOnly, ignoreNoMatch bool
+	interactive, useTrash, brokenOnly, forcePinned, orphans     bool
+	keepResources                                               bool
+	// Number of patterns that matched nothing.
+	unmatched int
+	// Number of programs removed, skipped, and failed to remove.
+	removed, skipped, errored int
+	// Template for list --format, or nil for the default output.
+	format *template.Template
+	// Program type to list, or "" to list all programs.
+	typeFilter string
+	// Absolute directory that symlink targets must be under, or "" for any.
+	targetsUnder string
+	// Absolute directory to move removed non-symlinks to, or "" to delete them.
+	backupDir string
+	// Names or globs of programs to exclude.
+	except []string
+	// Set of programs excluded by negated patterns.
+	excluded map[string]struct{}
 	// Keys of nameToAbsTarget in sorted order.
 	names []string
 	// Map from program basenames to absolute symlink targets, or to "" for non-symlinks.
@@ -403,53 +1949,337 @@ func newLsRmCommand(cmd *command) lsRmCommand {
 		c.pathToAbsTarget[path] = absTarget
 		c.absTargetToNames[absTarget] = append(c.absTargetToNames[absTarget], file.Name())
 	}
-	return c
+	c.sort(naturalLess)
+	return c
+}
+
+// sort sorts names and the values of absTargetToNames using less.
+func (c *lsRmCommand) sort(less func(a, b string) bool) {
+	sort.Slice(c.names, func(i, j int) bool { return less(c.names[i], c.names[j]) })
+	for _, names := range c.absTargetToNames {
+		sort.Slice(names, func(i, j int) bool { return less(names[i], names[j]) })
+	}
+}
+
+func (c *lsRmCommand) perform(action func(match), args []string) {
+	seen := make(map[string]struct{})
+	for _, arg := range args {
+		matches := c.find(arg)
+		if !c.ignoreNoMatch && len(matches) == 0 {
+			c.error("%s: no match found", arg)
+			c.unmatched++
+		}
+		for _, m := range matches {
+			if _, ok := seen[m.name]; ok {
+				continue
+			}
+			seen[m.name] = struct{}{}
+			if c.selected(m) {
+				action(m)
+			}
+		}
+	}
+}
+
+// exclude excludes programs matching the args prefixed by '!', and returns the
+// remaining args.
+func (c *lsRmCommand) exclude(args []string) []string {
+	var patterns, not []string
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '!' {
+			not = append(not, arg[1:])
+		} else {
+			patterns = append(patterns, arg)
+		}
+	}
+	c.excluded = make(map[string]struct{})
+	for _, pattern := range not {
+		for _, m := range c.find(pattern) {
+			c.excluded[m.name] = struct{}{}
+		}
+	}
+	return patterns
+}
+
+func (c *lsRmCommand) performAll(action func(match)) {
+	for _, name := range c.names {
+		if m := (match{name, c.nameToAbsTarget[name]}); c.selected(m) {
+			action(m)
+		}
+	}
+}
+
+// isOrphan returns true if match is a regular file with no recorded origin
+// that would be deleted permanently rather than moved to the trash or backed up.
+func (c *lsRmCommand) isOrphan(match match) bool {
+	if match.absTarget != "" || c.useTrash || c.backupDir != "" {
+		return false
+	}
+	p := c.state().lookup(match.name)
+	return p == nil || p.Origin == "" && p.Mode != modeShim
+}
+
+// isBroken returns true if match is a symlink whose target does not exist.
+func (c *lsRmCommand) isBroken(match match) bool {
+	if match.absTarget == "" {
+		return false
+	}
+	_, err := os.Stat(match.absTarget)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// selected returns true if match passes all the filters given by flags.
+func (c *lsRmCommand) selected(match match) bool {
+	if _, ok := c.excluded[match.name]; ok {
+		return false
+	}
+	for _, pattern := range c.except {
+		if ok, _ := filepath.Match(pattern, match.name); ok {
+			return false
+		}
+	}
+	if c.brokenOnly && !c.isBroken(match) {
+		return false
+	}
+	if c.targetsUnder != "" && !isUnder(match.absTarget, c.targetsUnder) {
+		return false
+	}
+	if c.typeFilter != "" {
+		typ, err := programType(filepath.Join(c.bin(), match.name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.error("%s: %s", match.name, err)
+			return false
+		}
+		if typ != c.typeFilter {
+			return false
+		}
+	}
+	return true
+}
+
+type match struct {
+	name, absTarget string
+}
+
+// listRecord is the data available to templates in list --format.
+type listRecord struct {
+	Name, Path, Target, AliasOf, Type string
+	Symlink, Broken, Pinned           bool
+}
+
+func (c *lsRmCommand) listProgram(match match) {
+	if c.format != nil {
+		c.formatProgram(match)
+		return
+	}
+	if line, ok := c.describe(match); ok {
+		fmt.Println(line)
+	}
+}
+
+// describe returns the line that list prints for match, or false if it fails.
+func (c *lsRmCommand) describe(match match) (string, bool) {
+	program := match.name
+	if c.showPath {
+		program = filepath.Join(c.bin(), match.name)
+	}
+	var suffix string
+	if original := c.aliasOf(match); original != "" {
+		suffix = " " + brightBlack(fmt.Sprintf("(alias of %s)", original))
+	}
+	if c.state().lookup(match.name).pinned() {
+		suffix += " " + brightBlack("(pinned)")
+	}
+	if !c.showTarget || match.absTarget == "" {
+		return fmt.Sprintf("%s%s", program, suffix), true
+	} else if _, err := os.Stat(match.absTarget); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("%s %s %s %s%s", program, brightBlack("->"), red(match.absTarget), brightBlack("(broken)"), suffix), true
+	} else if err != nil {
+		c.error("%s: %s", match.name, err)
+		return "", false
+	}
+	return fmt.Sprintf("%s %s %s%s", program, brightBlack("->"), blue(match.absTarget), suffix), true
+}
+
+func (c *lsRmCommand) formatProgram(match match) {
+	record := listRecord{
+		Name:    match.name,
+		Path:    filepath.Join(c.bin(), match.name),
+		Target:  match.absTarget,
+		AliasOf: c.aliasOf(match),
+		Symlink: match.absTarget != "",
+		Pinned:  c.state().lookup(match.name).pinned(),
+	}
+	if record.Symlink {
+		if _, err := os.Stat(match.absTarget); errors.Is(err, fs.ErrNotExist) {
+			record.Broken = true
+		} else if err != nil {
+			c.error("%s: %s", match.name, err)
+			return
+		}
+	}
+	if !record.Broken {
+		var err error
+		if record.Type, err = programType(record.Path); err != nil {
+			c.error("%s: %s", match.name, err)
+			return
+		}
+	}
+	if err := c.format.Execute(os.Stdout, record); err != nil {
+		c.fatal("%s: --format: %s", c.name, err)
+	}
+	fmt.Println()
+}
+
+// aliasOf returns the program that match was created as an alias of with
+// sim alias. Otherwise, it returns the first program (in sorted order) that
+// resolves to the same target as match, or "" if match is the first or only
+// one. Programs created with sim alias are never considered first.
+func (c *lsRmCommand) aliasOf(match match) string {
+	if original := c.state().lookup(match.name).original(); original != "" {
+		return original
+	}
+	if match.absTarget == "" {
+		return ""
+	}
+	for _, name := range c.absTargetToNames[match.absTarget] {
+		if c.state().lookup(name).original() != "" {
+			continue
+		}
+		if name == match.name {
+			return ""
+		}
+		return name
+	}
+	return ""
+}
+
+func (c *lsRmCommand) removeProgram(match match) {
+	line, ok := c.describe(match)
+	if !ok {
+		c.errored++
+		return
+	}
+	if !c.forcePinned && c.state().lookup(match.name).pinned() {
+		fmt.Printf("Skipping %s\n", line)
+		c.skipped++
+		return
+	}
+	if !c.orphans && c.isOrphan(match) {
+		if !isTerminal(os.Stdin) {
+			fmt.Printf("Skipping %s %s\n", line, brightBlack("(no known origin; use --orphans)"))
+			c.skipped++
+			return
+		}
+		if !confirm("%s has no known origin, so only sim undo can restore it until sim gc. Remove %s?", match.name, line) {
+			c.skipped++
+			return
+		}
+	} else if c.interactive {
+		if !confirm("Remove %s?", line) {
+			c.skipped++
+			return
+		}
+	} else {
+		fmt.Printf("Removing %s\n", line)
+	}
+	path := filepath.Join(c.bin(), match.name)
+	target := linkTarget(path)
+	var backup string
+	var err error
+	if c.useTrash {
+		err = c.trash(path)
+	} else if c.backupDir != "" && match.absTarget == "" {
+		backup, err = backupFile(c.backupDir, path)
+	} else if target == "" {
+		backup, err = c.stash(path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		c.error("%s: %s", match.name, err)
+		c.errored++
+		return
+	}
+	c.removed++
+	c.logBackup("remove", path, target, backup)
+	c.removeResources(match.name)
+	c.forget(match.name)
 }
 
-func (c *lsRmCommand) perform(action func(match), args []string) {
-	seen := make(map[string]struct{})
-	for _, arg := range args {
-		matches := c.find(arg)
-		if !c.ignoreNoMatch && len(matches) == 0 {
-			c.error("%s: no match found", arg)
+// removeResources removes the files associated with a removed program. Regular
+// files are stashed so that sim undo can restore them.
+func (c *lsRmCommand) removeResources(name string) {
+	p := c.state().lookup(name)
+	if p == nil || c.keepResources {
+		return
+	}
+	for _, resource := range p.Resources {
+		if c.interactive && !confirm("Remove %s resource %s?", name, resource) {
+			continue
 		}
-		for _, m := range matches {
-			if _, ok := seen[m.name]; ok {
-				continue
+		if !c.interactive {
+			fmt.Printf("Removing %s resource %s\n", name, blue(resource))
+		}
+		if c.useTrash {
+			if err := c.trash(resource); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				c.error("%s: %s", resource, err)
 			}
-			seen[m.name] = struct{}{}
-			action(m)
+			continue
+		}
+		if _, err := os.Lstat(resource); errors.Is(err, fs.ErrNotExist) {
+			continue
 		}
+		target := linkTarget(resource)
+		var backup string
+		var err error
+		if target == "" {
+			backup, err = c.stash(resource)
+		} else {
+			err = os.Remove(resource)
+		}
+		if err != nil {
+			c.error("%s: %s", resource, err)
+			continue
+		}
+		c.logBackup("remove", resource, target, backup)
 	}
 }
 
-type match struct {
-	name, absTarget string
-}
+const (
+	// Suffix format for backups, appended to the program name after '~'.
+	backupTimeFormat = "20060102T150405"
+	// How long prune --backup keeps backups.
+	backupExpiry = 30 * 24 * time.Hour
+)
 
-func (c *lsRmCommand) listProgram(match match) {
-	program := match.name
-	if c.showPath {
-		program = filepath.Join(c.bin(), match.name)
+// backupFile moves the file at path into dir, timestamping its name. It
+// returns the new path.
+func backupFile(dir, path string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
 	}
-	if !c.showTarget || match.absTarget == "" {
-		fmt.Printf("%s\n", program)
-	} else if _, err := os.Stat(match.absTarget); errors.Is(err, fs.ErrNotExist) {
-		fmt.Printf("%s %s %s %s\n", program, brightBlack("->"), red(match.absTarget), brightBlack("(broken)"))
-	} else if err != nil {
-		c.error("%s: %s", match.name, err)
-	} else {
-		fmt.Printf("%s %s %s\n", program, brightBlack("->"), blue(match.absTarget))
+	name := filepath.Base(path) + "~" + time.Now().Format(backupTimeFormat)
+	dest, err := reserve(dir, name, "", nil)
+	if err != nil {
+		return "", err
 	}
+	return dest, moveFile(path, dest)
 }
 
-func (c *lsRmCommand) removeProgram(match match) {
-	fmt.Print("Removing ")
-	c.listProgram(match)
-	path := filepath.Join(c.bin(), match.name)
-	if err := os.Remove(path); err != nil {
-		c.error("%s: %s", match.name, err)
+// parseBackupName returns the creation time encoded in a backup's name.
+func parseBackupName(name string) (time.Time, bool) {
+	i := strings.LastIndexByte(name, '~')
+	if i == -1 {
+		return time.Time{}, false
+	}
+	suffix := name[i+1:]
+	// Strip the counter added by reserve on collisions.
+	if j := strings.IndexByte(suffix, '.'); j != -1 {
+		suffix = suffix[:j]
 	}
+	t, err := time.ParseInLocation(backupTimeFormat, suffix, time.Local)
+	return t, err == nil
 }
 
 func (c *lsRmCommand) find(arg string) []match {
@@ -463,6 +2293,14 @@ func (c *lsRmCommand) find(arg string) []match {
 	if matchDirect {
 		if absTarget, ok := c.nameToAbsTarget[arg]; ok {
 			matches = append(matches, match{arg, absTarget})
+		} else if isGlob(arg) {
+			for _, name := range c.names {
+				if ok, err := filepath.Match(arg, name); err != nil {
+					c.fatal("%s: %s", arg, err)
+				} else if ok {
+					matches = append(matches, match{name, c.nameToAbsTarget[name]})
+				}
+			}
 		}
 		if absTarget, ok := c.pathToAbsTarget[abs]; ok {
 			matches = append(matches, match{filepath.Base(arg), absTarget})
@@ -477,64 +2315,292 @@ func (c *lsRmCommand) find(arg string) []match {
 }
 
 func (c *command) prune(opts *options) {
+	cmd := pruneCommand{command: c, report: []pruneEntry{}}
+	cmd.dryRun = opts.bool('n', "dry-run")
+	cmd.interactive = opts.bool('i', "interactive")
+	cmd.json = opts.bool('j', "json")
+	backupDir := opts.string('b', "backup")
+	targetsUnder := opts.string('u', "targets-under")
+	olderThan := opts.string('o', "older-than")
+	assumeMounted := opts.strings(0, "assume-mounted")
+	cmd.forcePinned = opts.bool(0, "force-pinned")
 	c.validate(opts, noArgs)
+	for i, dir := range assumeMounted {
+		assumeMounted[i] = c.abs(dir)
+	}
+	cmd.mounts = loadMounts(assumeMounted)
+	if cmd.dryRun && cmd.interactive {
+		c.fatal("%s: cannot use --dry-run and --interactive together", c.name)
+	}
+	if cmd.json && cmd.interactive {
+		c.fatal("%s: cannot use --json and --interactive together", c.name)
+	}
+	if olderThan != "" {
+		var err error
+		if cmd.olderThan, err = parseDuration(olderThan); err != nil {
+			c.fatal("%s: --older-than: %s", c.name, err)
+		}
+	}
+	if targetsUnder != "" {
+		cmd.targetsUnder = c.abs(targetsUnder)
+	}
+	if backupDir != "" {
+		cmd.expireBackups(c.abs(backupDir))
+	}
+	// Only clean up leftovers if the user did not narrow the scope.
+	cleanup := cmd.targetsUnder == "" && cmd.olderThan == 0
 	for _, file := range c.files() {
-		if skip(file) || !isSymlink(file.Type()) {
+		if cleanup && !file.IsDir() && isLeftover(file.Name()) {
+			cmd.removeFile(pruneEntry{Path: filepath.Join(c.bin(), file.Name()), Reason: reasonLeftover})
 			continue
 		}
-		path := filepath.Join(c.bin(), file.Name())
-		relOrAbsTarget, err := os.Readlink(path)
-		if err != nil {
-			c.error("%s", err)
+		if skip(file) || !isSymlink(file.Type()) {
 			continue
 		}
-		absTarget := ensureAbs(c.bin(), relOrAbsTarget)
-		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
-			fmt.Printf("Removing %s %s %s %s\n", file.Name(), brightBlack("->"), red(absTarget), brightBlack("(broken)"))
-			if err := os.Remove(path); err != nil {
-				c.error("%s: %s", file.Name(), err)
-			}
-		} else if err != nil {
-			c.fatal("%s: %s", file.Name(), err)
-		}
+		cmd.pruneProgram(file.Name())
+	}
+	if cleanup {
+		cmd.pruneState()
+	}
+	if cmd.json {
+		printJSON(cmd.report)
 	}
 }
 
-func (c *command) doctor(opts *options) {
-	c.validate(opts, noArgs)
-	for _, file := range c.files() {
-		path := filepath.Join(c.bin(), file.Name())
-		if file.IsDir() {
-			c.error("%s: unexpected directory", path)
-			continue
+type pruneCommand struct {
+	*command
+	dryRun, interactive, json, forcePinned bool
+	// Absolute directory that former targets must be under, or "" for any.
+	targetsUnder string
+	// Minimum time since the symlink was first found broken, or 0 for no
+	// minimum.
+	olderThan time.Duration
+	// Entries that were removed (or would be, for dry runs), for --json.
+	report []pruneEntry
+	mounts *mounts
+}
+
+// pruneEntry describes a file or metadata entry that prune removes.
+type pruneEntry struct {
+	Path string `json:"path"`
+	// Former symlink target, for broken symlinks.
+	Target string `json:"target,omitempty"`
+	Reason string `json:"reason"`
+	// False for dry runs, and if removal failed.
+	Removed bool `json:"removed"`
+	// True if the entry was not removed because it is pinned or its target is
+	// unreachable.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Reasons for removal in pruneEntry.
+const (
+	reasonBroken   = "broken"
+	reasonLeftover = "leftover file"
+	reasonExpired  = "expired backup"
+	reasonStale    = "stale metadata"
+	// Reasons for skipped entries.
+	reasonPinned      = "pinned"
+	reasonUnreachable = "unreachable"
+)
+
+func (e pruneEntry) String() string {
+	if e.Target != "" {
+		return fmt.Sprintf("%s %s %s %s", filepath.Base(e.Path), brightBlack("->"), red(e.Target), brightBlack("("+e.Reason+")"))
+	}
+	if e.Reason == reasonStale || e.Reason == reasonPinned {
+		return fmt.Sprintf("%s %s", filepath.Base(e.Path), brightBlack("("+e.Reason+")"))
+	}
+	return fmt.Sprintf("%s %s", e.Path, brightBlack("("+e.Reason+")"))
+}
+
+func (c *pruneCommand) pruneProgram(name string) {
+	path := filepath.Join(c.bin(), name)
+	relOrAbsTarget, err := os.Readlink(path)
+	if err != nil {
+		c.error("%s", err)
+		return
+	}
+	absTarget := ensureAbs(c.bin(), relOrAbsTarget)
+	if c.targetsUnder != "" && !isUnder(absTarget, c.targetsUnder) {
+		return
+	}
+	if _, err := c.mounts.stat(path, absTarget); err == nil {
+		if !c.dryRun {
+			c.markWorking(name)
 		}
-		if skip(file) {
-			continue
+		return
+	} else if isUnreachableError(err) {
+		// If the filesystem is assumed mounted, the target is just broken.
+		if !c.mounts.assumes(absTarget) {
+			c.skip(pruneEntry{Path: path, Target: absTarget, Reason: fmt.Sprintf("%s: %s", reasonUnreachable, err)}, "--assume-mounted")
+			return
 		}
-		if info, err := os.Stat(path); isSymlink(file.Type()) && errors.Is(err, fs.ErrNotExist) {
-			c.error("%s: broken symlink", path)
-			continue
-		} else if err != nil {
-			c.error("%s", err)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: %s", name, err)
+		return
+	}
+	if dir := c.mounts.unmounted(absTarget); dir != "" {
+		c.skip(pruneEntry{Path: path, Target: absTarget, Reason: fmt.Sprintf("%s: %s is not mounted", reasonUnreachable, dir)}, "--assume-mounted")
+		return
+	}
+	if since := c.brokenSince(name, !c.dryRun); time.Since(since) < c.olderThan {
+		return
+	}
+	if !c.forcePinned && c.state().lookup(name).pinned() {
+		c.skip(pruneEntry{Path: path, Target: absTarget, Reason: reasonPinned}, "--force-pinned")
+		return
+	}
+	if c.removeFile(pruneEntry{Path: path, Target: absTarget, Reason: reasonBroken}) {
+		c.forget(name)
+	}
+}
+
+// removeFile removes the entry's file after printing it, unless the user
+// declines in interactive mode or this is a dry run. For stale metadata, it
+// forgets the program instead. Returns true if it removed the entry.
+func (c *pruneCommand) removeFile(e pruneEntry) bool {
+	prompt, verb, dryVerb := "Remove", "Removing", "Would remove"
+	if e.Reason == reasonStale {
+		prompt, verb, dryVerb = "Forget", "Forgetting", "Would forget"
+	}
+	if c.interactive {
+		if !confirm("%s %s?", prompt, e) {
+			return false
+		}
+	} else if c.dryRun {
+		c.log("%s %s", dryVerb, e)
+		c.report = append(c.report, e)
+		return false
+	} else {
+		c.log("%s %s", verb, e)
+	}
+	inBin := isUnder(e.Path, c.bin())
+	target := linkTarget(e.Path)
+	var backup string
+	var err error
+	switch {
+	case e.Reason == reasonStale:
+		c.logChange("forget", e.Path, "")
+		c.forget(filepath.Base(e.Path))
+	case inBin && target == "":
+		backup, err = c.stash(e.Path)
+	default:
+		err = os.Remove(e.Path)
+	}
+	if err != nil {
+		c.error("%s: %s", e.Path, err)
+		c.report = append(c.report, e)
+		return false
+	}
+	if inBin && e.Reason != reasonStale {
+		c.logBackup("remove", e.Path, target, backup)
+	}
+	e.Removed = true
+	c.report = append(c.report, e)
+	return true
+}
+
+// skip reports an entry that is not removed because it is pinned or might only
+// be unreachable, along with the flag that would remove it.
+func (c *pruneCommand) skip(e pruneEntry, flag string) {
+	e.Skipped = true
+	c.log("Skipping %s %s", e, brightBlack("(use "+flag+" to prune)"))
+	c.report = append(c.report, e)
+}
+
+// log prints a line of human-readable output, unless printing JSON.
+func (c *pruneCommand) log(format string, args ...interface{}) {
+	if !c.json {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// pruneState removes metadata for programs that no longer exist, as well as
+// temporary files left behind in the state directory.
+func (c *pruneCommand) pruneState() {
+	var names []string
+	for name := range c.state().Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(c.bin(), name)
+		if _, err := os.Lstat(path); err == nil || c.isDisabled(name) {
 			continue
-		} else if !isExecutable(info.Mode()) {
-			c.error("%s: not an executable", path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			c.error("%s: %s", name, err)
 			continue
 		}
-		if !isSymlink(file.Type()) {
+		if !c.forcePinned && c.state().lookup(name).pinned() {
+			c.skip(pruneEntry{Path: path, Reason: reasonPinned}, "--force-pinned")
 			continue
 		}
-		relOrAbsTarget, err := os.Readlink(path)
-		if err != nil {
-			c.error("%s", err)
-			continue
+		c.removeFile(pruneEntry{Path: path, Reason: reasonStale})
+	}
+	dir := filepath.Dir(c.stateFile())
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		c.fatal("reading %s: %s", dir, err)
+	}
+	for _, file := range files {
+		if !file.IsDir() && isLeftover(file.Name()) {
+			c.removeFile(pruneEntry{Path: filepath.Join(dir, file.Name()), Reason: reasonLeftover})
 		}
-		if filepath.IsAbs(relOrAbsTarget) &&
-			strings.HasPrefix(relOrAbsTarget, c.home()+string(filepath.Separator)) {
-			c.error("%s: symlink is absolute (should be relative)", path)
+	}
+}
+
+// expireBackups removes backups in dir created by remove --backup that are
+// older than backupExpiry.
+func (c *pruneCommand) expireBackups(dir string) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		c.fatal("reading %s: %s", dir, err)
+	}
+	for _, file := range files {
+		created, ok := parseBackupName(file.Name())
+		if !ok || time.Since(created) < backupExpiry {
 			continue
 		}
+		c.removeFile(pruneEntry{Path: filepath.Join(dir, file.Name()), Reason: reasonExpired})
+	}
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// isTerminal returns true if f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm prompts the user with a yes/no question, defaulting to no.
+func confirm(format string, args ...interface{}) bool {
+	fmt.Printf(format, args...)
+	fmt.Print(" [y/N] ")
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// printJSON prints v to stdout as indented JSON.
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
 	}
+	fmt.Println(string(data))
 }
 
 func (c *command) error(format string, args ...interface{}) {
@@ -545,16 +2611,31 @@ func (c *command) error(format string, args ...interface{}) {
 
 func (c *command) fatal(format string, args ...interface{}) {
 	c.error(format, args...)
+	c.abort()
+}
+
+// abort exits after a fatal error. In sim batch, it only ends the current line.
+func (c *command) abort() {
+	if c.batch {
+		panic(errBatchAbort)
+	}
+	// Keep track of changes made before the error so they can be undone.
+	if !c.aborting {
+		c.aborting = true
+		c.saveState()
+		c.saveJournal()
+	}
 	os.Exit(1)
 }
 
 type options struct {
 	args []string
-	// Maps each flag to the index of its potential argument in args, or to -1
-	// if it is followed by another flag or by nothing. We don't map directly to
-	// strings because at this stage we don't know what flags take arguments.
-	short map[rune]int
-	long  map[string]int
+	// Maps each flag to the indexes of its potential arguments in args (one
+	// for each occurrence), using -1 if it is followed by another flag or by
+	// nothing. We don't map directly to strings because at this stage we don't
+	// know what flags take arguments.
+	short map[rune][]int
+	long  map[string][]int
 	// Errors to report during validation.
 	errors []string
 }
@@ -565,8 +2646,8 @@ func (opts *options) error(format string, args ...interface{}) {
 
 func parseOptions(raw []string) *options {
 	opts := options{
-		short: make(map[rune]int),
-		long:  make(map[string]int),
+		short: make(map[rune][]int),
+		long:  make(map[string][]int),
 	}
 	var index int
 	nop := func() {}
@@ -581,29 +2662,23 @@ func parseOptions(raw []string) *options {
 			}
 			if len(arg) >= 3 && strings.HasPrefix(arg, "--") {
 				key := arg[2:]
-				if _, ok := opts.long[key]; ok {
-					opts.error("--%s: duplicate flag", key)
-					setArgIndex = nop
-				} else {
-					opts.long[key] = -1
-					setArgIndex = func() {
-						opts.long[key] = index
-					}
+				opts.long[key] = append(opts.long[key], -1)
+				n := len(opts.long[key]) - 1
+				setArgIndex = func() {
+					opts.long[key][n] = index
 				}
 				continue
 			}
 			if len(arg) >= 2 && strings.HasPrefix(arg, "-") {
 				chars := []rune(arg[1:])
 				for _, r := range chars {
-					if _, ok := opts.short[r]; ok {
-						opts.error("-%c: duplicate flag", r)
-					} else {
-						opts.short[r] = -1
-					}
+					opts.short[r] = append(opts.short[r], -1)
 				}
 				if len(chars) == 1 {
+					r := chars[0]
+					n := len(opts.short[r]) - 1
 					setArgIndex = func() {
-						opts.short[chars[0]] = index
+						opts.short[r][n] = index
 					}
 				} else {
 					setArgIndex = nop
@@ -621,11 +2696,15 @@ func parseOptions(raw []string) *options {
 
 func (o *options) shift() (string, bool) {
 	flagArgs := make(map[int]struct{})
-	for _, i := range o.short {
-		flagArgs[i] = struct{}{}
+	for _, indexes := range o.short {
+		for _, i := range indexes {
+			flagArgs[i] = struct{}{}
+		}
 	}
-	for _, i := range o.long {
-		flagArgs[i] = struct{}{}
+	for _, indexes := range o.long {
+		for _, i := range indexes {
+			flagArgs[i] = struct{}{}
+		}
 	}
 	for i, arg := range o.args {
 		if _, ok := flagArgs[i]; !ok {
@@ -642,66 +2721,81 @@ func (o *options) tryShift() string {
 }
 
 func (o *options) bool(short rune, long string) bool {
-	var shortOk, longOk bool
-	if _, shortOk = o.short[short]; shortOk {
-		delete(o.short, short)
-	}
-	if _, longOk = o.long[long]; longOk {
-		delete(o.long, long)
-	}
-	if shortOk && longOk {
+	shortN, longN := len(o.short[short]), len(o.long[long])
+	delete(o.short, short)
+	delete(o.long, long)
+	if shortN > 0 && longN > 0 {
 		o.error("duplicate flags -%c and --%s", short, long)
+	} else if shortN > 1 {
+		o.error("-%c: duplicate flag", short)
+	} else if longN > 1 {
+		o.error("--%s: duplicate flag", long)
 	}
-	return shortOk || longOk
+	return shortN > 0 || longN > 0
 }
 
 func (o *options) string(short rune, long string) string {
-	var (
-		i               int
-		shortOk, longOk bool
-		value           string
-	)
-	if i, shortOk = o.short[short]; shortOk {
-		delete(o.short, short)
-		if i == -1 {
-			o.error("-%c: missing argument", short)
-		} else {
-			value = o.args[i]
-			o.removeArg(i)
-		}
+	shortN, longN := len(o.short[short]), len(o.long[long])
+	values := o.strings(short, long)
+	if shortN > 0 && longN > 0 {
+		o.error("duplicate flags -%c and --%s", short, long)
+	} else if shortN > 1 {
+		o.error("-%c: duplicate flag", short)
+	} else if longN > 1 {
+		o.error("--%s: duplicate flag", long)
 	}
-	if _, longOk = o.long[long]; longOk {
-		delete(o.long, long)
-		if i == -1 {
-			o.error("--%s: missing argument", long)
-		} else {
-			value = o.args[i]
-			o.removeArg(i)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// strings returns the arguments of a flag that can be given multiple times, in
+// the order they appear on the command line.
+func (o *options) strings(short rune, long string) []string {
+	var indexes []int
+	collect := func(flagIndexes []int, name string) {
+		for _, i := range flagIndexes {
+			if i == -1 {
+				o.error("%s: missing argument", name)
+			} else {
+				indexes = append(indexes, i)
+			}
 		}
 	}
-	if shortOk && longOk {
-		o.error("duplicate flags -%c and --%s", short, long)
+	collect(o.short[short], fmt.Sprintf("-%c", short))
+	collect(o.long[long], "--"+long)
+	delete(o.short, short)
+	delete(o.long, long)
+	sort.Ints(indexes)
+	var values []string
+	for _, i := range indexes {
+		values = append(values, o.args[i])
 	}
-	return value
+	// Remove from the end so that removeArg does not shift the rest.
+	for n := len(indexes) - 1; n >= 0; n-- {
+		o.removeArg(indexes[n])
+	}
+	return values
 }
 
 func (o *options) removeArg(index int) {
 	o.args = append(o.args[:index], o.args[index+1:]...)
-	for k, i := range o.short {
-		if i == index {
-			panic("flags should have distinct arg indexes")
-		}
-		if i > index {
-			o.short[k]--
+	adjust := func(indexes []int) {
+		for n, i := range indexes {
+			if i == index {
+				panic("flags should have distinct arg indexes")
+			}
+			if i > index {
+				indexes[n]--
+			}
 		}
 	}
-	for k, i := range o.long {
-		if i == index {
-			panic("flags should have distinct arg indexes")
-		}
-		if i > index {
-			o.long[k]--
-		}
+	for _, indexes := range o.short {
+		adjust(indexes)
+	}
+	for _, indexes := range o.long {
+		adjust(indexes)
 	}
 }
 
@@ -736,8 +2830,16 @@ func (c *command) validate(opts *options, validation argValidation) {
 		c.error("%s: %s", c.name, err)
 	}
 	if c.failed {
-		os.Exit(1)
+		c.abort()
+	}
+}
+
+func (c *command) abs(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		c.fatal("%s: %s", path, err)
 	}
+	return abs
 }
 
 func (c *command) home() string {
@@ -752,6 +2854,23 @@ func (c *command) home() string {
 	return c.homeDir
 }
 
+func (c *command) dataHome() string {
+	return c.xdgDir("XDG_DATA_HOME", ".local", "share")
+}
+
+// xdgDir returns the value of the environment variable key, falling back to
+// a path relative to the home directory.
+func (c *command) xdgDir(key string, elem ...string) string {
+	dir := os.Getenv(key)
+	if dir == "" {
+		return filepath.Join(append([]string{c.home()}, elem...)...)
+	}
+	if !filepath.IsAbs(dir) {
+		c.fatal("%s: %s should be absolute", dir, key)
+	}
+	return dir
+}
+
 func (c *command) bin() string {
 	if c.binDir != "" {
 		return c.binDir
@@ -766,17 +2885,69 @@ func (c *command) bin() string {
 }
 
 func (c *command) files() []fs.DirEntry {
+	if c.dir != nil {
+		return c.dir
+	}
 	files, err := os.ReadDir(c.bin())
-	if err != nil {
+	if errors.Is(err, fs.ErrNotExist) {
+		c.fatal("%s: does not exist (create it with sim doctor --create)", c.bin())
+	} else if err != nil {
 		c.fatal("reading %s: %s", c.bin(), err)
 	}
+	if c.batch {
+		c.dir = files
+	}
 	return files
 }
 
+// lstatProgram returns the path and file info of a program in the bin
+// directory. It reports an error and returns false if it cannot.
+func (c *command) lstatProgram(name string) (string, fs.FileInfo, bool) {
+	// Names like "../foo" must not escape the bin directory.
+	if !c.validName(name) {
+		return "", nil, false
+	}
+	path := filepath.Join(c.bin(), name)
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: program not found", name)
+		return "", nil, false
+	} else if err != nil {
+		c.error("%s: %s", name, err)
+		return "", nil, false
+	}
+	return path, info, true
+}
+
 func skip(file fs.DirEntry) bool {
 	return file.IsDir() || strings.HasPrefix(file.Name(), ".")
 }
 
+// isLeftover returns true if name looks like a temporary or backup file, such
+// as those left behind by interrupted writes or text editors.
+func isLeftover(name string) bool {
+	for _, suffix := range []string{".tmp", ".bak", ".swp", ".swo", "~"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")
+}
+
+// formatSize formats a number of bytes using binary prefixes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 func isSymlink(mode fs.FileMode) bool {
 	return mode&os.ModeSymlink != 0
 }
@@ -785,6 +2956,123 @@ func isExecutable(mode fs.FileMode) bool {
 	return mode&0o111 != 0
 }
 
+const (
+	typeScript = "script"
+	typeBinary = "binary"
+)
+
+// programType sniffs the first bytes of the file at path (following symlinks)
+// and returns typeScript, typeBinary, or "" if it is neither.
+func programType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return sniffType(magic[:n]), nil
+}
+
+func sniffType(magic []byte) string {
+	if bytes.HasPrefix(magic, []byte("#!")) {
+		return typeScript
+	}
+	for _, m := range binaryMagics {
+		if bytes.Equal(magic, m) {
+			return typeBinary
+		}
+	}
+	return ""
+}
+
+// binaryMagics are the magic numbers of ELF and Mach-O executables.
+var binaryMagics = [][]byte{
+	{0x7f, 'E', 'L', 'F'},
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+// parseDuration is like time.ParseDuration but also accepts whole numbers of
+// days and weeks such as "30d" and "2w". The duration must be positive.
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	d, err := time.ParseDuration(s)
+	for suffix, unit := range units {
+		if n, convErr := strconv.Atoi(strings.TrimSuffix(s, suffix)); convErr == nil && strings.HasSuffix(s, suffix) {
+			d, err = time.Duration(n)*unit, nil
+		}
+	}
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("invalid duration %q: must be positive", s)
+	}
+	return d, err
+}
+
+// naturalLess compares strings like "tool-2" < "tool-10" by treating runs of
+// digits as numbers. It falls back to byte order for ties like "01" and "1".
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x := strings.TrimLeft(a[si:i], "0")
+			y := strings.TrimLeft(b[sj:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+// unescape replaces the escape sequences \t, \n, and \\ in s, since shells make
+// it awkward to pass literal tabs and newlines.
+func unescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n").Replace(s)
+}
+
+// isGlob returns true if arg is a glob pattern for program names.
+func isGlob(arg string) bool {
+	return !strings.ContainsRune(arg, filepath.Separator) && strings.ContainsAny(arg, "*?[")
+}
+
+// isUnder returns true if path is dir or is inside dir. Both must be clean.
+func isUnder(path, dir string) bool {
+	if path == "" {
+		return false
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
 func ensureAbs(base string, relOrAbs string) string {
 	if filepath.IsAbs(relOrAbs) {
 		return relOrAbs
@@ -796,10 +3084,7 @@ var noColor = func() bool {
 	if _, ok := os.LookupEnv("NO_COLOR"); ok {
 		return true
 	}
-	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
-		return true
-	}
-	return false
+	return !isTerminal(os.Stdout)
 }()
 
 func red(s string) string {
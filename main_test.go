@@ -0,0 +1,294 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testEnv points sim at empty directories in a temporary home directory and
+// returns the home directory, which has an empty bin directory.
+func testEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_BIN_HOME", filepath.Join(home, "bin"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+	if err := os.Mkdir(filepath.Join(home, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+// writeScript writes an executable script at path that prints text.
+func writeScript(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho "+text+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runSim runs a sim command like main does, except that fatal errors do not
+// exit. It returns false if the command failed.
+func runSim(t *testing.T, args ...string) bool {
+	t.Helper()
+	c := command{args: args}
+	ok := c.runLine(args)
+	c.saveState()
+	return ok
+}
+
+// loadState reads the state file written by sim.
+func loadState(t *testing.T) *state {
+	t.Helper()
+	c := command{}
+	return c.state()
+}
+
+// saveTestState overwrites the state file.
+func saveTestState(t *testing.T, st *state) {
+	t.Helper()
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := command{}
+	if err := writeFileAtomic(c.stateFile(), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exists returns true if there is a file or symlink at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestOptionsStrings(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want []string
+		rest []string
+	}{
+		{nil, nil, nil},
+		{[]string{"foo"}, nil, []string{"foo"}},
+		{[]string{"-m", "a"}, []string{"a"}, nil},
+		{[]string{"--match", "a"}, []string{"a"}, nil},
+		{[]string{"-m", "a", "--match", "b", "-m", "c"}, []string{"a", "b", "c"}, nil},
+		{[]string{"--match", "a", "-m", "b", "foo"}, []string{"a", "b"}, []string{"foo"}},
+		{[]string{"foo", "-m", "a", "bar", "--match", "b", "baz"}, []string{"a", "b"}, []string{"foo", "bar", "baz"}},
+		{[]string{"-m", "a", "--", "-m", "b"}, []string{"a"}, []string{"-m", "b"}},
+		{[]string{"-m", "--", "a"}, nil, []string{"a"}},
+	} {
+		opts := parseOptions(tc.args)
+		got := opts.strings('m', "match")
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: strings = %q, want %q", tc.args, got, tc.want)
+		}
+		// Compare with append so that nil and empty slices are equal.
+		if !reflect.DeepEqual(append([]string{}, opts.args...), append([]string{}, tc.rest...)) {
+			t.Errorf("%q: remaining args = %q, want %q", tc.args, opts.args, tc.rest)
+		}
+	}
+}
+
+func TestOptionsStringsMissingArgument(t *testing.T) {
+	opts := parseOptions([]string{"-m", "a", "--match"})
+	if got, want := opts.strings('m', "match"), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("strings = %q, want %q", got, want)
+	}
+	if want := []string{"--match: missing argument"}; !reflect.DeepEqual(opts.errors, want) {
+		t.Errorf("errors = %q, want %q", opts.errors, want)
+	}
+}
+
+func TestOptionsMixedFlags(t *testing.T) {
+	opts := parseOptions([]string{"install", "-f", "--format", "{{.Name}}", "-r", "bar", "foo"})
+	if got, ok := opts.shift(); !ok || got != "install" {
+		t.Fatalf("shift = %q, %t, want install", got, ok)
+	}
+	if !opts.bool('f', "force") {
+		t.Error("expected -f")
+	}
+	if got := opts.string(0, "format"); got != "{{.Name}}" {
+		t.Errorf("--format = %q, want {{.Name}}", got)
+	}
+	if got := opts.string('r', "rename"); got != "bar" {
+		t.Errorf("-r = %q, want bar", got)
+	}
+	if want := []string{"foo"}; !reflect.DeepEqual(opts.args, want) {
+		t.Errorf("remaining args = %q, want %q", opts.args, want)
+	}
+	if len(opts.errors) != 0 {
+		t.Errorf("unexpected errors: %q", opts.errors)
+	}
+}
+
+func TestOptionsStringDuplicate(t *testing.T) {
+	for _, args := range [][]string{
+		{"-s", "a", "-s", "b"},
+		{"--since", "a", "--since", "b"},
+		{"-s", "a", "--since", "b"},
+	} {
+		opts := parseOptions(args)
+		if got := opts.string('s', "since"); got != "a" {
+			t.Errorf("%q: string = %q, want a", args, got)
+		}
+		if len(opts.errors) != 1 {
+			t.Errorf("%q: errors = %q, want one error", args, opts.errors)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"tool-2", "tool-10", true},
+		{"tool-10", "tool-2", false},
+		{"tool", "tool-2", true},
+		{"tool-2", "tool", false},
+		{"a", "b", true},
+		{"a1", "b0", true},
+		{"1", "a", true},
+		{"go-1.9.7", "go-1.22.1", true},
+		{"go-1.22.1", "go-1.22.10", true},
+		{"x9a", "x10", true},
+		{"same", "same", false},
+		{"tool-2", "tool-2", false},
+		// Ties in numeric value fall back to byte order.
+		{"01", "1", true},
+		{"1", "01", false},
+		{"a01b", "a1b", true},
+		{"a1b", "a01b", false},
+		{"tool-007", "tool-7", true},
+	} {
+		if got := naturalLess(tc.a, tc.b); got != tc.want {
+			t.Errorf("naturalLess(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestNaturalLessSort(t *testing.T) {
+	names := []string{"v10", "v1", "v02", "v2", "v", "v1a", "v01"}
+	want := []string{"v", "v01", "v1", "v1a", "v02", "v2", "v10"}
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	for i := range names {
+		if names[i] != want[i] {
+			t.Fatalf("got %q, want %q", names, want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want time.Duration
+	}{
+		{"1d", 24 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"1s", time.Second},
+	} {
+		got, err := parseDuration(tc.s)
+		if err != nil {
+			t.Errorf("parseDuration(%q): unexpected error: %s", tc.s, err)
+		} else if got != tc.want {
+			t.Errorf("parseDuration(%q) = %s, want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestParseDurationErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0",
+		"0d",
+		"0s",
+		"-1d",
+		"-2w",
+		"-1h",
+		"30",
+		"d",
+		"1.5d",
+		"1d12h",
+		"1y",
+		"30 d",
+	} {
+		if got, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q) = %s, want error", s, got)
+		}
+	}
+}
+
+func TestPruneOlderThan(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	link := filepath.Join(home, "bin", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	if err := os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	// A dry run must not record anything.
+	runSim(t, "prune", "--dry-run", "--older-than", "1h")
+	if _, ok := loadState(t).Broken["foo"]; ok {
+		t.Error("prune --dry-run recorded a broken symlink")
+	}
+	// The first real run only records when the link was found broken.
+	runSim(t, "prune", "--older-than", "1h")
+	if !exists(link) {
+		t.Fatal("removed a symlink that was just found broken")
+	}
+	st := loadState(t)
+	if _, ok := st.Broken["foo"]; !ok {
+		t.Fatal("prune did not record the broken symlink")
+	}
+	st.Broken["foo"] = time.Now().Add(-2 * time.Hour)
+	saveTestState(t, st)
+	runSim(t, "prune", "--older-than", "1h")
+	if exists(link) {
+		t.Error("did not remove a symlink broken for longer than --older-than")
+	}
+	if _, ok := loadState(t).Broken["foo"]; ok {
+		t.Error("did not forget the removed symlink")
+	}
+}
+
+func TestPruneForgetsRepairedLinks(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	saveTestState(t, &state{Broken: map[string]time.Time{"foo": time.Now().Add(-48 * time.Hour)}})
+	runSim(t, "prune", "--dry-run")
+	if _, ok := loadState(t).Broken["foo"]; !ok {
+		t.Error("prune --dry-run changed the state")
+	}
+	runSim(t, "prune", "--older-than", "1h")
+	if !exists(filepath.Join(home, "bin", "foo")) {
+		t.Fatal("removed a working symlink")
+	}
+	if _, ok := loadState(t).Broken["foo"]; ok {
+		t.Error("did not forget that a repaired symlink was broken")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func (c *command) man(opts *options) {
+	output := opts.string('o', "output")
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	if output == "" {
+		name := ""
+		if len(opts.args) == 1 {
+			if name = canonicalCommand(opts.args[0]); name == "" {
+				c.fatal("%s: unrecognized command", opts.args[0])
+			}
+		}
+		page, ok := manPage(name)
+		if !ok {
+			c.fatal("%s: no manual page (see sim(1))", name)
+		}
+		fmt.Print(page)
+		return
+	}
+	if len(opts.args) != 0 {
+		c.fatal("%s: cannot use --output with COMMAND", c.name)
+	}
+	if err := os.MkdirAll(output, 0o755); err != nil {
+		c.fatal("%s", err)
+	}
+	names := []string{""}
+	for _, spec := range commandSpecs() {
+		names = append(names, spec.Name)
+	}
+	for _, name := range names {
+		page, ok := manPage(name)
+		if !ok {
+			continue
+		}
+		file := filepath.Join(output, manPageName(name)+".1")
+		if err := os.WriteFile(file, []byte(page), 0o644); err != nil {
+			c.fatal("%s", err)
+		}
+		fmt.Println(file)
+	}
+}
+
+// manPageName returns the name of the manual page for a command, or for sim
+// itself if name is "".
+func manPageName(name string) string {
+	if name == "" {
+		return "sim"
+	}
+	return "sim-" + name
+}
+
+// manPage renders the manual page for a command (or sim itself if name is "")
+// from its help message. It returns false for commands without their own help.
+func manPage(name string) (string, bool) {
+	printUsage, ok := usageFor(name)
+	if !ok || name != "" && !hasOwnHelp(name) {
+		return "", false
+	}
+	summary := "manage programs in $XDG_BIN_HOME"
+	for _, spec := range commandSpecs() {
+		if spec.Name == name {
+			summary = spec.Summary
+		}
+	}
+	var b strings.Builder
+	title := manPageName(name)
+	fmt.Fprintf(&b, ".TH %s 1 \"\" sim \"sim manual\"\n", strings.ToUpper(roffEscape(title)))
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roffEscape(title), roffEscape(summary))
+	paras := strings.Split(strings.TrimRight(helpText(printUsage), "\n"), "\n\n")
+	synopsis := strings.TrimPrefix(paras[0], "Usage: ")
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n%s\n", roffEscape(synopsis))
+	description := true
+	for _, para := range paras[1:] {
+		lines := strings.Split(para, "\n")
+		if heading := lines[0]; len(lines) > 1 && strings.HasSuffix(heading, ":") && !strings.HasPrefix(heading, " ") {
+			fmt.Fprintf(&b, ".SH %s\n", strings.ToUpper(strings.TrimSuffix(heading, ":")))
+			writeManEntries(&b, lines[1:], name == "")
+			continue
+		}
+		if description {
+			b.WriteString(".SH DESCRIPTION\n")
+			description = false
+		} else if strings.HasPrefix(para, "    ") {
+			// Indented paragraphs are examples, shown verbatim.
+			b.WriteString(".IP\n.nf\n")
+			for _, line := range lines {
+				fmt.Fprintf(&b, "%s\n", roffEscape(strings.TrimPrefix(line, "    ")))
+			}
+			b.WriteString(".fi\n")
+			continue
+		} else {
+			b.WriteString(".PP\n")
+		}
+		text := strings.Join(lines, " ")
+		if !strings.HasSuffix(text, ".") && !strings.HasSuffix(text, ":") {
+			text += "."
+		}
+		fmt.Fprintf(&b, "%s\n", roffEscape(text))
+	}
+	if name != "" {
+		b.WriteString(".SH SEE ALSO\n.BR sim (1)\n")
+	}
+	return b.String(), true
+}
+
+// hasOwnHelp returns true if a command has a help message other than the one
+// for sim itself.
+func hasOwnHelp(name string) bool {
+	printUsage, ok := usageFor(name)
+	return ok && helpText(printUsage) != helpText(usage)
+}
+
+var manEntryRegexp = regexp.MustCompile(`^    (\S.*?)(?:\s{2,}(.*))?$`)
+
+// writeManEntries writes the entries of a help section like "Options:" as
+// tagged paragraphs. If commands is true, it refers to their manual pages.
+func writeManEntries(b *strings.Builder, lines []string, commands bool) {
+	for _, line := range lines {
+		m := manEntryRegexp.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(line, "     ") {
+			// Continuation of the previous entry's description.
+			fmt.Fprintf(b, "%s\n", roffEscape(strings.TrimSpace(line)))
+			continue
+		}
+		term := m[1]
+		names := strings.Split(term, ", ")
+		if name := names[len(names)-1]; commands && hasOwnHelp(name) {
+			term = fmt.Sprintf("\\fB%s\\fR (see \\fB%s\\fR(1))", roffEscape(term), roffEscape(manPageName(name)))
+		} else {
+			term = "\\fB" + roffEscape(term) + "\\fR"
+		}
+		fmt.Fprintf(b, ".TP\n%s\n", term)
+		if m[2] != "" {
+			fmt.Fprintf(b, "%s\n", roffEscape(m[2]))
+		}
+	}
+}
+
+// roffEscape escapes text for use in a roff document.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
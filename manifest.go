@@ -0,0 +1,301 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifest describes the programs in the bin directory in a form that can be
+// replayed on another machine. It is stored as JSON.
+type manifest struct {
+	Programs []manifestEntry `json:"programs"`
+}
+
+// manifestEntry describes how to install a single program. Paths under the
+// home directory are written with a leading "~/" so that manifests work on
+// machines with different home directories.
+type manifestEntry struct {
+	Name string `json:"name"`
+	// How to install the program: modeSymlink, modeCopy, or modeShim.
+	Mode string `json:"mode"`
+	// Symlink target, for symlinks.
+	Target string `json:"target,omitempty"`
+	// File to copy from, for copies.
+	Origin string `json:"origin,omitempty"`
+	// Name of the program this is an alias of, if any.
+	Original string `json:"original,omitempty"`
+	// Command line to exec, for shims.
+	Command []string `json:"command,omitempty"`
+	// SHA-256 of the program (or its target, for symlinks) when installed.
+	Checksum string `json:"checksum,omitempty"`
+	Pinned   bool   `json:"pinned,omitempty"`
+}
+
+// manifest returns a manifest for the programs in the bin directory. Programs
+// that cannot be installed again, such as moves, are left out.
+func (c *command) manifest() manifest {
+	m := manifest{Programs: []manifestEntry{}}
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		name := file.Name()
+		p := c.state().lookup(name)
+		e := manifestEntry{Name: name, Pinned: p.pinned()}
+		switch {
+		case p.original() != "":
+			e.Mode = modeSymlink
+			e.Original = p.Original
+		case isSymlink(file.Type()):
+			e.Mode = modeSymlink
+			e.Target = c.portablePath(ensureAbs(c.bin(), linkTarget(filepath.Join(c.bin(), name))))
+			if p != nil {
+				e.Checksum = p.TargetChecksum
+			}
+		case p != nil && p.Mode == modeCopy && p.Origin != "":
+			e.Mode = modeCopy
+			e.Origin = c.portablePath(p.Origin)
+			e.Checksum = p.Checksum
+		case p != nil && p.Mode == modeShim && len(p.Command) != 0:
+			e.Mode = modeShim
+			e.Command = p.Command
+		default:
+			continue
+		}
+		m.Programs = append(m.Programs, e)
+	}
+	sort.Slice(m.Programs, func(i, j int) bool {
+		return naturalLess(m.Programs[i].Name, m.Programs[j].Name)
+	})
+	return m
+}
+
+// portablePath replaces the home directory prefix of path with "~".
+func (c *command) portablePath(path string) string {
+	if isUnder(path, c.home()) {
+		rel, err := filepath.Rel(c.home(), path)
+		if err == nil {
+			return filepath.Join("~", rel)
+		}
+	}
+	return path
+}
+
+// localPath expands a path from a manifest for this machine.
+func (c *command) localPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(c.home(), path[1:])
+	}
+	return path
+}
+
+// writeManifest writes a manifest to a file.
+func (c *command) writeManifest(file string, m manifest) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		c.fatal("encoding manifest: %s", err)
+	}
+	if err := writeFileAtomic(file, append(data, '\n'), 0o644); err != nil {
+		c.fatal("%s", err)
+	}
+}
+
+// readManifest reads a manifest file, or stdin if file is "-".
+func (c *command) readManifest(file string) manifest {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		c.fatal("%s", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		c.fatal("%s: invalid manifest: %s", file, err)
+	}
+	for _, e := range m.Programs {
+		if !c.validName(e.Name) {
+			c.fatal("%s: invalid manifest", file)
+		}
+	}
+	return m
+}
+
+// entryStatus is the result of installing a manifest entry.
+type entryStatus int
+
+const (
+	// The program was installed.
+	entryInstalled entryStatus = iota
+	// The program was already installed as described.
+	entrySatisfied
+	// A different program with the same name is installed.
+	entryConflict
+	// The program could not be installed, e.g. because its source is missing.
+	entryFailed
+)
+
+// installEntries installs the programs in a manifest that are not in the bin
+// directory. Aliases are installed last, since they refer to other programs.
+// It returns the number of entries with each status.
+func (c *command) installEntries(m manifest) map[entryStatus]int {
+	counts := make(map[entryStatus]int)
+	var aliases []manifestEntry
+	for _, e := range m.Programs {
+		if e.Original != "" {
+			aliases = append(aliases, e)
+		} else {
+			counts[c.installEntry(e)]++
+		}
+	}
+	for _, e := range aliases {
+		counts[c.installEntry(e)]++
+	}
+	return counts
+}
+
+// installEntry installs a program from a manifest unless one with the same
+// name is already installed. It reports entries that cannot be installed, but
+// not conflicts with installed programs.
+func (c *command) installEntry(e manifestEntry) entryStatus {
+	path := filepath.Join(c.bin(), e.Name)
+	if _, err := os.Lstat(path); err == nil {
+		if c.satisfies(e) {
+			return entrySatisfied
+		}
+		return entryConflict
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: %s", e.Name, err)
+		return entryFailed
+	}
+	source, ok := c.entrySource(e)
+	if !ok {
+		return entryFailed
+	}
+	switch {
+	case e.Original != "":
+		original, target, ok := c.aliasTarget(e.Original)
+		if !ok {
+			break
+		}
+		fmt.Printf("Aliasing %s %s %s\n", e.Name, brightBlack("->"), original)
+		if err := os.Symlink(target, path); err != nil {
+			c.error("%s: %s", e.Name, err)
+			break
+		}
+		c.logChange("alias", path, target)
+		c.recordAlias(e.Name, original)
+	case e.Mode == modeSymlink:
+		if cmd, ok := newInstallCommand(c, source, false, e.Name); ok {
+			cmd.symlink()
+		}
+	case e.Mode == modeCopy:
+		if cmd, ok := newInstallCommand(c, source, false, e.Name); ok {
+			cmd.copy()
+		}
+	case e.Mode == modeShim:
+		c.installShim(e.Name, e.Command)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return entryFailed
+	}
+	if e.Pinned {
+		if p := c.state().lookup(e.Name); p != nil && !p.Pinned {
+			p.Pinned = true
+			c.modified()
+		}
+	}
+	return entryInstalled
+}
+
+// entrySource returns the file a manifest entry is installed from, or the
+// original program for aliases. It reports an error if the file is missing.
+// Shims have no source, so it returns an empty string for them.
+func (c *command) entrySource(e manifestEntry) (string, bool) {
+	var source string
+	switch {
+	case e.Mode == modeShim && len(e.Command) != 0:
+		return "", true
+	case e.Original != "":
+		source = filepath.Join(c.bin(), e.Original)
+	case e.Mode == modeSymlink && e.Target != "":
+		source = c.localPath(e.Target)
+	case e.Mode == modeCopy && e.Origin != "":
+		source = c.localPath(e.Origin)
+	default:
+		c.error("%s: invalid manifest entry", e.Name)
+		return "", false
+	}
+	if _, err := os.Lstat(source); errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: source not found: %s", e.Name, source)
+		return "", false
+	}
+	return source, true
+}
+
+// satisfies returns true if the program in the bin directory with the same
+// name as e was installed as e describes.
+func (c *command) satisfies(e manifestEntry) bool {
+	path := filepath.Join(c.bin(), e.Name)
+	p := c.state().lookup(e.Name)
+	switch {
+	case e.Original != "":
+		return p.original() == e.Original
+	case e.Mode == modeSymlink:
+		target, err := os.Readlink(path)
+		return err == nil && ensureAbs(c.bin(), target) == c.localPath(e.Target)
+	case e.Mode == modeCopy:
+		return p != nil && p.Mode == modeCopy && p.Origin == c.localPath(e.Origin)
+	case e.Mode == modeShim:
+		return p != nil && p.Mode == modeShim &&
+			strings.Join(p.Command, "\x00") == strings.Join(e.Command, "\x00")
+	}
+	return false
+}
+
+func (c *command) export(opts *options) {
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	if len(opts.args) == 0 || opts.args[0] == "-" {
+		printJSON(c.manifest())
+		return
+	}
+	file := opts.args[0]
+	m := c.manifest()
+	c.writeManifest(file, m)
+	fmt.Printf("Exported %d programs to %s\n", len(m.Programs), blue(file))
+}
+
+func (c *command) importManifest(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	file := opts.args[0]
+	m := c.readManifest(file)
+	for _, e := range m.Programs {
+		if _, err := os.Lstat(filepath.Join(c.bin(), e.Name)); err == nil && !c.satisfies(e) {
+			c.error("%s: a different program with this name is already installed", e.Name)
+		}
+	}
+	counts := c.installEntries(m)
+	fmt.Printf(
+		"Installed %d, already satisfied %d, failed %d\n",
+		counts[entryInstalled], counts[entrySatisfied],
+		counts[entryConflict]+counts[entryFailed],
+	)
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) migrate(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	yes := opts.bool('y', "yes")
+	copy := opts.bool('c', "copy")
+	move := opts.bool('m', "move")
+	c.validate(opts, atLeastOneArg)
+	if copy && move {
+		c.fatal("%s: cannot use --copy and --move together", c.name)
+	}
+	if len(opts.args) != 1 {
+		c.fatal("%s: expected a single DIR", c.name)
+	}
+	dir := c.abs(opts.args[0])
+	if sameDir(dir, c.bin()) {
+		c.fatal("%s: cannot migrate from the bin directory", dir)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		c.fatal("%s", err)
+	}
+	for _, file := range files {
+		if skip(file) {
+			continue
+		}
+		name := file.Name()
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || !isExecutable(info.Mode()) {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(c.bin(), name)); err == nil {
+			fmt.Printf("Skipping %s %s\n", name, brightBlack("(already in bin)"))
+			continue
+		}
+		// Preserve symlinks by installing their targets directly.
+		source := path
+		if isSymlink(file.Type()) && !move {
+			if relOrAbsTarget, err := os.Readlink(path); err == nil {
+				source = ensureAbs(dir, relOrAbsTarget)
+			}
+		}
+		if dryRun {
+			fmt.Printf("Would install %s %s %s\n", name, brightBlack("from"), blue(source))
+			continue
+		}
+		if !yes && !confirm("Install %s from %s?", name, source) {
+			continue
+		}
+		cmd, ok := newInstallCommand(c, source, false, name)
+		if !ok {
+			continue
+		}
+		if copy {
+			cmd.copy()
+		} else if move {
+			cmd.move()
+		} else {
+			cmd.symlink()
+		}
+	}
+}
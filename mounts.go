@@ -0,0 +1,173 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// How long to wait for stat before assuming the file is on a hung mount.
+const statTimeout = 3 * time.Second
+
+var errStatTimeout = errors.New("timed out (unresponsive mount?)")
+
+// statWithTimeout is like os.Stat but gives up after statTimeout. The stat
+// call keeps running in the background, which is fine for a short-lived CLI.
+func statWithTimeout(path string) (fs.FileInfo, error) {
+	type result struct {
+		info fs.FileInfo
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		info, err := os.Stat(path)
+		ch <- result{info, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.info, r.err
+	case <-time.After(statTimeout):
+		return nil, errStatTimeout
+	}
+}
+
+// isUnreachableError returns true if err suggests a network filesystem is
+// unavailable, as opposed to the file not existing.
+func isUnreachableError(err error) bool {
+	return errors.Is(err, errStatTimeout) || isUnreachableErrno(err)
+}
+
+// networkFilesystems are filesystem types that can be unreachable.
+var networkFilesystems = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smbfs": true, "smb3": true,
+	"afpfs": true, "webdav": true, "davfs": true, "fuse.sshfs": true,
+	"sshfs": true, "fuse.rclone": true, "glusterfs": true, "ceph": true,
+}
+
+// mounts knows which network filesystems are expected and which are mounted.
+type mounts struct {
+	// Mount points of network filesystems listed in /etc/fstab.
+	expected []string
+	// Mount points of currently mounted filesystems.
+	mounted map[string]bool
+	// Directories the user says to treat as mounted.
+	assumed []string
+	// Mount points where a stat has timed out.
+	hung map[string]bool
+}
+
+func loadMounts(assumed []string) *mounts {
+	m := mounts{mounted: make(map[string]bool), assumed: assumed, hung: make(map[string]bool)}
+	for _, entry := range readMountTable("/etc/fstab") {
+		if networkFilesystems[entry.fstype] {
+			m.expected = append(m.expected, entry.dir)
+		}
+	}
+	if runtime.GOOS == "linux" {
+		for _, entry := range readMountTable("/proc/self/mounts") {
+			m.mounted[entry.dir] = true
+		}
+	} else if out, err := exec.Command("mount").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if match := mountLineRegexp.FindStringSubmatch(line); match != nil {
+				m.mounted[match[1]] = true
+			}
+		}
+	}
+	return &m
+}
+
+// Matches lines like "//host/share on /Volumes/share (smbfs, nodev)".
+var mountLineRegexp = regexp.MustCompile(`^.* on (.*) \([^,)]+`)
+
+type mountEntry struct {
+	dir, fstype string
+}
+
+// readMountTable parses a file in fstab(5) format, ignoring errors.
+func readMountTable(path string) []mountEntry {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var entries []mountEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		dir := strings.ReplaceAll(fields[1], `\040`, " ")
+		entries = append(entries, mountEntry{dir: filepath.Clean(dir), fstype: fields[2]})
+	}
+	return entries
+}
+
+// stat is like statWithTimeout for a symlink at path pointing to target. Once a
+// stat times out, it fails right away for other targets on the same mount
+// instead of waiting for each one.
+func (m *mounts) stat(path, target string) (fs.FileInfo, error) {
+	dir := m.mountPoint(target)
+	if m.hung[dir] {
+		return nil, errStatTimeout
+	}
+	info, err := statWithTimeout(path)
+	if errors.Is(err, errStatTimeout) && dir != "" {
+		m.hung[dir] = true
+	}
+	return info, err
+}
+
+// mountPoint returns the mount point of the mounted filesystem containing path,
+// or "" if it is unknown.
+func (m *mounts) mountPoint(path string) string {
+	var result string
+	for dir := range m.mounted {
+		if len(dir) > len(result) && isUnder(path, dir) {
+			result = dir
+		}
+	}
+	return result
+}
+
+// assumes returns true if path is in a directory the user says is mounted.
+func (m *mounts) assumes(path string) bool {
+	for _, dir := range m.assumed {
+		if isUnder(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmounted returns the mount point of an expected but missing mount that
+// contains path, or "" if there is none.
+func (m *mounts) unmounted(path string) string {
+	if m.assumes(path) {
+		return ""
+	}
+	for _, dir := range m.expected {
+		if !m.mounted[dir] && isUnder(path, dir) {
+			return dir
+		}
+	}
+	// On macOS, removable and network volumes are mounted under /Volumes.
+	if runtime.GOOS == "darwin" && isUnder(path, "/Volumes") {
+		rest := strings.TrimPrefix(path, "/Volumes/")
+		dir := filepath.Join("/Volumes", strings.SplitN(rest, "/", 2)[0])
+		if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+			return dir
+		}
+	}
+	return ""
+}
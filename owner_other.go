@@ -0,0 +1,12 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+
+package main
+
+import "io/fs"
+
+// ownedByUser returns false since file ownership is not available.
+func ownedByUser(info fs.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+func (c *command) pin(opts *options) {
+	c.validate(opts, anyArgs)
+	if len(opts.args) == 0 {
+		var names []string
+		for name, p := range c.state().Programs {
+			if p.Pinned {
+				names = append(names, name)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	for _, name := range opts.args {
+		if _, _, ok := c.lstatProgram(name); !ok {
+			continue
+		}
+		p := c.state().program(name)
+		if p.Pinned {
+			continue
+		}
+		fmt.Printf("Pinning %s\n", name)
+		p.Pinned = true
+		c.modified()
+	}
+}
+
+func (c *command) unpin(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		p := c.state().lookup(name)
+		if !p.pinned() {
+			c.error("%s: not pinned", name)
+			continue
+		}
+		fmt.Printf("Unpinning %s\n", name)
+		p.Pinned = false
+		c.modified()
+	}
+}
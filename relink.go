@@ -0,0 +1,82 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) relink(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 2 {
+		c.fatal("%s: expected OLD-PREFIX and NEW-PREFIX", c.name)
+	}
+	oldPrefix, newPrefix := c.abs(opts.args[0]), c.abs(opts.args[1])
+	var relinked int
+	for _, file := range c.files() {
+		if skip(file) || !isSymlink(file.Type()) {
+			continue
+		}
+		name := file.Name()
+		path := filepath.Join(c.bin(), name)
+		relOrAbsTarget, err := os.Readlink(path)
+		if err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		absTarget := ensureAbs(c.bin(), relOrAbsTarget)
+		if !isUnder(absTarget, oldPrefix) {
+			continue
+		}
+		rest, err := filepath.Rel(oldPrefix, absTarget)
+		if err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		newAbsTarget := filepath.Join(newPrefix, rest)
+		if _, err := os.Stat(newAbsTarget); errors.Is(err, fs.ErrNotExist) && !force {
+			c.error("%s: %s does not exist (relink anyway with --force)", name, newAbsTarget)
+			continue
+		} else if err != nil && !force {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("Would relink %s %s %s\n", name, brightBlack("->"), blue(newAbsTarget))
+			continue
+		}
+		fmt.Printf("Relinking %s %s %s\n", name, brightBlack("->"), blue(newAbsTarget))
+		if c.retarget(name, relOrAbsTarget, newAbsTarget) {
+			relinked++
+		}
+	}
+	if relinked == 0 && !dryRun && !c.failed {
+		fmt.Printf("No symlinks point under %s\n", oldPrefix)
+	}
+}
+
+// retarget points the symlink for a program at newAbsTarget. It keeps absolute
+// symlinks absolute and relative ones relative, based on its old target.
+func (c *command) retarget(name, relOrAbsTarget, newAbsTarget string) bool {
+	path := filepath.Join(c.bin(), name)
+	newTarget := newAbsTarget
+	if !filepath.IsAbs(relOrAbsTarget) {
+		var err error
+		if newTarget, err = filepath.Rel(c.bin(), newAbsTarget); err != nil {
+			c.error("%s: %s", name, err)
+			return false
+		}
+	}
+	if err := replaceSymlink(newTarget, path); err != nil {
+		c.error("%s: %s", name, err)
+		return false
+	}
+	c.logChange("relink", path, newTarget)
+	return true
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (c *command) rename(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 2 {
+		c.fatal("%s: expected OLD and NEW", c.name)
+	}
+	oldName, newName := opts.args[0], opts.args[1]
+	if !c.validName(newName) {
+		return
+	}
+	oldPath, _, ok := c.lstatProgram(oldName)
+	if !ok {
+		return
+	}
+	newPath := filepath.Join(c.bin(), newName)
+	if _, err := os.Lstat(newPath); err == nil {
+		if !force {
+			c.fatal("%s: %s exists (overwrite with --force)", oldName, newName)
+		}
+		c.forget(newName)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.fatal("%s: %s", newName, err)
+	}
+	fmt.Printf("Renaming %s %s %s\n", oldName, brightBlack("to"), newName)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		c.fatal("%s: %s", oldName, err)
+	}
+	c.logChange("rename", oldPath, newName)
+	if p := c.state().lookup(oldName); p != nil {
+		*c.state().program(newName) = *p
+		c.forget(oldName)
+	}
+	c.renameOriginal(oldName, newName)
+}
+
+// renameOriginal updates aliases of a program that was renamed.
+func (c *command) renameOriginal(oldName, newName string) {
+	for name, p := range c.state().Programs {
+		if p.Original != oldName {
+			continue
+		}
+		p.Original = newName
+		c.modified()
+		path := filepath.Join(c.bin(), name)
+		if target, err := os.Readlink(path); err == nil && target == oldName {
+			if err := replaceSymlink(newName, path); err != nil {
+				c.error("%s: %s", name, err)
+			} else {
+				c.logChange("relink", path, newName)
+			}
+		}
+	}
+}
+
+func (c *command) alias(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) != 2 {
+		c.fatal("%s: expected NAME and EXISTING", c.name)
+	}
+	name, existing := opts.args[0], opts.args[1]
+	if !c.validName(name) {
+		return
+	}
+	original, target, ok := c.aliasTarget(existing)
+	if !ok {
+		return
+	}
+	if name == existing || name == original {
+		c.fatal("%s: cannot alias a program to itself", name)
+	}
+	path := filepath.Join(c.bin(), name)
+	if force {
+		if err := c.overwrite(path); err != nil {
+			c.fatal("%s: %s", name, err)
+		}
+		c.forget(name)
+	}
+	fmt.Printf("Aliasing %s %s %s\n", name, brightBlack("->"), original)
+	if err := os.Symlink(target, path); errors.Is(err, fs.ErrExist) {
+		c.fatal("%s: %s exists (overwrite with --force)", existing, name)
+	} else if err != nil {
+		c.fatal("%s: %s", name, err)
+	}
+	// Log it as an install so that sim undo can remove it.
+	c.logChange("install", path, ensureAbs(c.bin(), target))
+	c.recordAlias(name, original)
+}
+
+// aliasTarget returns the program that an alias of existing should refer to,
+// which is existing itself unless it is an alias too, and the target for the
+// alias symlink. If existing is a symlink, the alias points to the same
+// target. Otherwise, it points to existing.
+func (c *command) aliasTarget(existing string) (original, target string, ok bool) {
+	existingPath, info, ok := c.lstatProgram(existing)
+	if !ok {
+		return "", "", false
+	}
+	original = existing
+	if o := c.state().lookup(existing).original(); o != "" {
+		original = o
+	}
+	target = original
+	if isSymlink(info.Mode()) {
+		var err error
+		if target, err = os.Readlink(existingPath); err != nil {
+			c.error("%s: %s", existing, err)
+			return "", "", false
+		}
+	}
+	return original, target, true
+}
+
+// recordAlias records that name is an alias of original.
+func (c *command) recordAlias(name, original string) {
+	p := c.state().program(name)
+	*p = programState{Mode: modeSymlink, Installed: stamp(), Original: original}
+	c.modified()
+}
+
+// validName checks that name can be used for a program in the bin directory.
+func (c *command) validName(name string) bool {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		c.error("%s: invalid program name", name)
+		return false
+	}
+	if strings.HasPrefix(name, ".") {
+		c.error("%s: program must not start with '.'", name)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// repairCandidate is a file that a broken symlink could be retargeted to.
+type repairCandidate struct {
+	path string
+	// Whether the file has the checksum recorded when the program was
+	// installed.
+	sameChecksum bool
+}
+
+func (c *command) repair(opts *options) {
+	yes := opts.bool('y', "yes")
+	dryRun := opts.bool('n', "dry-run")
+	sources := opts.strings('s', "source")
+	c.validate(opts, anyArgs)
+	roots := c.sourceRoots(sources)
+	if len(roots) == 0 {
+		c.fatal("%s: no source roots (use --source or sim sources add)", c.name)
+	}
+	// Map from program names to their old targets.
+	broken := make(map[string]string)
+	var names []string
+	if len(opts.args) == 0 {
+		for _, file := range c.files() {
+			if !skip(file) && isSymlink(file.Type()) {
+				names = append(names, file.Name())
+			}
+		}
+	} else {
+		for _, name := range opts.args {
+			if _, _, ok := c.lstatProgram(name); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(c.bin(), name)
+		target, err := os.Readlink(path)
+		if err != nil {
+			if len(opts.args) != 0 {
+				c.error("%s: not a symlink", name)
+			}
+			continue
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			if len(opts.args) != 0 {
+				c.error("%s: not a broken symlink", name)
+			}
+			continue
+		}
+		broken[name] = target
+	}
+	if len(broken) == 0 {
+		if !c.failed {
+			fmt.Println("No broken symlinks")
+		}
+		return
+	}
+	// Find files with the same basename as the old targets in one pass.
+	wanted := make(map[string]bool)
+	for _, target := range broken {
+		wanted[filepath.Base(target)] = true
+	}
+	found := make(map[string][]string)
+	c.walkSources(roots, func(path string, info fs.FileInfo) {
+		if base := filepath.Base(path); wanted[base] {
+			found[base] = append(found[base], path)
+		}
+	})
+	for _, name := range names {
+		if target, ok := broken[name]; ok {
+			c.repairProgram(name, target, found[filepath.Base(target)], yes, dryRun)
+		}
+	}
+}
+
+// repairProgram retargets the broken symlink for a program to one of paths.
+func (c *command) repairProgram(name, relOrAbsTarget string, paths []string, yes, dryRun bool) {
+	base := filepath.Base(relOrAbsTarget)
+	if len(paths) == 0 {
+		c.error("%s: no file called %s in source roots", name, base)
+		return
+	}
+	sum := ""
+	if p := c.state().lookup(name); p != nil {
+		sum = p.TargetChecksum
+	}
+	candidates := make([]repairCandidate, len(paths))
+	matches := 0
+	for i, path := range paths {
+		candidates[i].path = path
+		if sum != "" {
+			if s, err := checksum(path); err == nil && s == sum {
+				candidates[i].sameChecksum = true
+				matches++
+			}
+		}
+	}
+	// Prefer files with the same checksum.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].sameChecksum && !candidates[j].sameChecksum
+	})
+	old := ensureAbs(c.bin(), relOrAbsTarget)
+	fmt.Printf("Broken %s %s %s\n", name, brightBlack("->"), blue(old))
+	for i, cand := range candidates {
+		desc := blue(cand.path)
+		if cand.sameChecksum {
+			desc += " " + brightBlack("(same checksum)")
+		}
+		fmt.Printf("    %d) %s\n", i+1, desc)
+	}
+	choice := 0
+	if dryRun {
+		fmt.Printf("Would repair %s %s %s\n", name, brightBlack("->"), blue(candidates[0].path))
+		return
+	} else if yes {
+		if len(candidates) > 1 && matches != 1 {
+			c.error("%s: found %d files called %s (choose one without --yes)", name, len(candidates), base)
+			return
+		}
+	} else if len(candidates) == 1 {
+		if !confirm("Repair %s?", name) {
+			return
+		}
+	} else {
+		var ok bool
+		if choice, ok = choose("Use", len(candidates), 0); !ok {
+			return
+		}
+	}
+	newAbsTarget := candidates[choice].path
+	fmt.Printf("Repairing %s %s %s\n", name, brightBlack("->"), blue(newAbsTarget))
+	c.retarget(name, relOrAbsTarget, newAbsTarget)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// resolve returns the absolute path of the file that a program in the bin
+// directory resolves to after following all symlinks. It reports an error and
+// returns false if it cannot.
+func (c *command) resolve(name string) (string, bool) {
+	path, _, ok := c.lstatProgram(name)
+	if !ok {
+		return "", false
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: broken symlink", name)
+		return "", false
+	} else if err != nil {
+		c.error("%s: %s", name, err)
+		return "", false
+	}
+	return target, true
+}
+
+func (c *command) edit(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	var paths []string
+	for _, name := range opts.args {
+		if path, ok := c.resolve(name); ok {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Use the shell so that editors with arguments like "code -w" work.
+	args := append([]string{"-c", editor + ` "$@"`, "sh"}, paths...)
+	cmd := exec.Command("sh", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		c.error("running %s: %s", editor, err)
+	}
+}
+
+// How many bytes of a binary file cat shows in its hex dump.
+const catDumpSize = 64
+
+func (c *command) cat(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		path, ok := c.resolve(name)
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			c.error("%s: %s", name, err)
+			continue
+		}
+		if !isBinaryData(data) {
+			os.Stdout.Write(data)
+			continue
+		}
+		summary := "binary file"
+		if info, err := readBinaryInfo(path); err == nil {
+			summary = fmt.Sprintf("%s binary (%s)", formatName(info.format), strings.Join(info.archs, ", "))
+		}
+		fmt.Printf("%s: %s, %s\n", name, summary, formatSize(int64(len(data))))
+		if len(data) > catDumpSize {
+			data = data[:catDumpSize]
+		}
+		fmt.Print(hex.Dump(data))
+	}
+}
+
+// isBinaryData returns true if data looks like a binary rather than text.
+func isBinaryData(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func (c *command) open(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		path, ok := c.resolve(name)
+		if !ok {
+			continue
+		}
+		var cmd *exec.Cmd
+		if runtime.GOOS == "darwin" {
+			cmd = exec.Command("open", "-R", path)
+		} else {
+			// There is no standard way to select a file, so open its directory.
+			cmd = exec.Command("xdg-open", filepath.Dir(path))
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			msg := strings.TrimSpace(string(out))
+			if msg == "" {
+				msg = err.Error()
+			}
+			c.error("%s: running %s: %s", name, cmd.Args[0], msg)
+		}
+	}
+}
+
+func (c *command) target(opts *options) {
+	cmd := newLsRmCommand(c)
+	cmd.validate(opts, atLeastOneArg)
+	cmd.perform(func(m match) {
+		if path, ok := c.resolve(m.name); ok {
+			fmt.Println(path)
+		}
+	}, opts.args)
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func (c *command) search(opts *options) {
+	install := opts.bool('i', "install")
+	yes := opts.bool('y', "yes")
+	sources := opts.strings('s', "source")
+	c.validate(opts, anyArgs)
+	if len(opts.args) > 1 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	pattern := ""
+	if len(opts.args) == 1 {
+		pattern = opts.args[0]
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			c.fatal("%s: %s", pattern, err)
+		}
+	}
+	roots := c.sourceRoots(sources)
+	if len(roots) == 0 {
+		c.fatal("%s: no source roots (use --source or sim sources add)", c.name)
+	}
+	installed := c.installedSources()
+	var found []string
+	c.walkSources(roots, func(path string, info fs.FileInfo) {
+		name := filepath.Base(path)
+		if !matchName(pattern, name) || installed[path] {
+			return
+		}
+		if real, err := filepath.EvalSymlinks(path); err == nil && installed[real] {
+			return
+		}
+		if _, err := os.Lstat(filepath.Join(c.bin(), name)); err == nil {
+			return
+		}
+		found = append(found, path)
+	})
+	sort.SliceStable(found, func(i, j int) bool {
+		return naturalLess(filepath.Base(found[i]), filepath.Base(found[j]))
+	})
+	for _, path := range found {
+		name := filepath.Base(path)
+		if !install {
+			fmt.Printf("%s %s\n", name, blue(path))
+			continue
+		}
+		// An earlier match with the same name might have been installed.
+		if _, err := os.Lstat(filepath.Join(c.bin(), name)); err == nil {
+			continue
+		}
+		if !yes && !confirm("Install %s from %s?", name, path) {
+			continue
+		}
+		if cmd, ok := newInstallCommand(c, path, false, name); ok {
+			cmd.symlink()
+		}
+	}
+}
+
+// installedSources returns the absolute paths that programs in the bin
+// directory are symlinked to or were copied from.
+func (c *command) installedSources() map[string]bool {
+	sources := make(map[string]bool)
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		path := filepath.Join(c.bin(), file.Name())
+		if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+			sources[target] = true
+		}
+	}
+	for _, p := range c.state().Programs {
+		if p.Origin != "" {
+			sources[p.Origin] = true
+		}
+	}
+	return sources
+}
+
+// matchName returns true if name matches pattern, which is a glob or else a
+// substring to search for. An empty pattern matches everything.
+func matchName(pattern, name string) bool {
+	if isGlob(pattern) {
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	}
+	return strings.Contains(name, pattern)
+}
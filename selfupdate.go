@@ -0,0 +1,201 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesURL is the GitHub API endpoint for the latest release. Each release
+// has binaries named sim-GOOS-GOARCH and a SHA256SUMS file listing them.
+var releasesURL = "https://api.github.com/repos/mk12/sim/releases/latest"
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL for the named asset.
+func (r *release) assetURL(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+func (c *command) selfupdate(opts *options) {
+	check := opts.bool('c', "check")
+	force := opts.bool('f', "force")
+	c.validate(opts, noArgs)
+	current := readBuildInfo().Version
+	var latest release
+	if err := getJSON(releasesURL, &latest); err != nil {
+		c.fatal("%s: checking for releases: %s", c.name, err)
+	}
+	latestVersion := strings.TrimPrefix(latest.Tag, "v")
+	if !force {
+		if current == "" || strings.HasPrefix(current, "0.0.0-") {
+			c.fatal("%s: this is a development build (replace it anyway with --force)", c.name)
+		}
+		if !versionLess(current, latestVersion) {
+			fmt.Printf("sim %s is up to date\n", current)
+			return
+		}
+	}
+	if check {
+		fmt.Printf("Update available: %s %s %s\n", current, brightBlack("->"), latestVersion)
+		return
+	}
+	asset := fmt.Sprintf("sim-%s-%s", runtime.GOOS, runtime.GOARCH)
+	url, ok := latest.assetURL(asset)
+	if !ok {
+		c.fatal("%s: release %s has no binary for %s/%s", c.name, latest.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL, ok := latest.assetURL("SHA256SUMS")
+	if !ok {
+		c.fatal("%s: release %s has no SHA256SUMS", c.name, latest.Tag)
+	}
+	want, err := releaseChecksum(sumsURL, asset)
+	if err != nil {
+		c.fatal("%s: %s", c.name, err)
+	}
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		c.fatal("%s: finding executable: %s", c.name, err)
+	}
+	fmt.Printf("Updating %s %s %s\n", blue(exe), brightBlack("to"), latestVersion)
+	tmp, got, err := download(url)
+	if err != nil {
+		c.fatal("%s: %s", c.name, err)
+	}
+	if got != want {
+		err = fmt.Errorf("%s: checksum mismatch (expected %s, got %s)", asset, want, got)
+	} else if err = os.Chmod(tmp, 0o755); err == nil {
+		err = replaceWithCopy(tmp, exe)
+	}
+	os.Remove(tmp)
+	if err != nil {
+		c.fatal("%s: %s", c.name, err)
+	}
+	// If sim manages itself, keep its metadata accurate.
+	if filepath.Dir(exe) == c.bin() {
+		if p := c.state().lookup(filepath.Base(exe)); p != nil {
+			c.logChange("update", exe, url)
+			p.Checksum = got
+			p.Installed = stamp()
+			c.modified()
+		}
+	}
+}
+
+// getJSON fetches a URL and decodes the JSON response into v.
+func getJSON(url string, v interface{}) error {
+	resp, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpGet performs a GET request, treating non-2xx statuses as errors.
+func httpGet(url string) (*http.Response, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// releaseChecksum returns the SHA-256 listed for name in a SHA256SUMS file.
+func releaseChecksum(url, name string) (string, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("SHA256SUMS: no entry for %s", name)
+}
+
+// download saves a URL to a temporary file and returns its path and the
+// SHA-256 of its content.
+func download(url string) (string, string, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	f, err := os.CreateTemp("", "sim-download-")
+	if err != nil {
+		return "", "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// versionLess returns true if semantic version a is older than b. It only
+// compares the numeric major, minor, and patch components.
+func versionLess(a, b string) bool {
+	as, bs := versionNumbers(a), versionNumbers(b)
+	for i := range as {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return false
+}
+
+func versionNumbers(v string) [3]int {
+	var nums [3]int
+	if i := strings.IndexAny(v, "-+"); i != -1 {
+		v = v[:i]
+	}
+	for i, part := range strings.SplitN(v, ".", 3) {
+		nums[i], _ = strconv.Atoi(part)
+	}
+	return nums
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// shadowRecord lists the executables in $PATH with the same name as a program.
+type shadowRecord struct {
+	Name string `json:"name"`
+	// Executables called Name in $PATH order. The first one is what runs.
+	Paths []string `json:"paths"`
+	// Whether the program in the bin directory is not the first in Paths.
+	Shadowed bool `json:"shadowed"`
+}
+
+func (c *command) shadow(opts *options) {
+	all := opts.bool('a', "all")
+	json := opts.bool('j', "json")
+	c.validate(opts, anyArgs)
+	names := opts.args
+	if len(names) == 0 {
+		for _, file := range c.files() {
+			if !skip(file) {
+				names = append(names, file.Name())
+			}
+		}
+	} else {
+		all = true
+	}
+	records := []shadowRecord{}
+	for _, name := range names {
+		if _, _, ok := c.lstatProgram(name); !ok {
+			continue
+		}
+		r := c.shadowRecord(name)
+		if all || len(r.Paths) > 1 || r.Shadowed {
+			records = append(records, r)
+		}
+	}
+	if json {
+		printJSON(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("No programs are shadowed")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROGRAM\tSTATUS\tPATH")
+	for _, r := range records {
+		name := r.Name
+		ours := filepath.Join(c.bin(), r.Name)
+		for i, path := range r.Paths {
+			status := "shadowed"
+			if i == 0 {
+				status = "wins"
+			}
+			if path == ours {
+				path += " (sim)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, status, path)
+			name = ""
+		}
+		if len(r.Paths) == 0 || r.Shadowed && !contains(r.Paths, ours) {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, "not in $PATH", ours+" (sim)")
+		}
+	}
+	w.Flush()
+}
+
+// shadowRecord finds the executables in $PATH with the same name as a program
+// in the bin directory.
+func (c *command) shadowRecord(name string) shadowRecord {
+	r := shadowRecord{Name: name, Paths: []string{}}
+	ours := filepath.Join(c.bin(), name)
+	var dirs []string
+	for _, path := range findInPath(name) {
+		dir := filepath.Dir(path)
+		if sameDir(dir, c.bin()) {
+			path = ours
+		}
+		// Skip directories that appear in $PATH more than once, possibly
+		// under different names.
+		seen := false
+		for _, d := range dirs {
+			seen = seen || sameDir(d, dir)
+		}
+		if !seen {
+			dirs = append(dirs, dir)
+			r.Paths = append(r.Paths, path)
+		}
+	}
+	r.Shadowed = len(r.Paths) == 0 || r.Paths[0] != ours
+	return r
+}
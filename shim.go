@@ -0,0 +1,67 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) shim(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) < 2 {
+		c.fatal("%s: expected NAME and COMMAND", c.name)
+	}
+	name, argv := opts.args[0], opts.args[1:]
+	if !c.validName(name) {
+		return
+	}
+	path := filepath.Join(c.bin(), name)
+	if _, err := os.Lstat(path); err == nil {
+		if !force {
+			c.fatal("%s: already exists (overwrite with --force)", name)
+		}
+		if err := c.overwrite(path); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.fatal("%s: %s", name, err)
+	}
+	c.installShim(name, argv)
+}
+
+// shimScript returns a shell script that execs argv with its own arguments
+// appended.
+func shimScript(argv []string) string {
+	return fmt.Sprintf("#!/bin/sh\n# Generated by sim shim.\nexec %s \"$@\"\n", shellJoin(argv))
+}
+
+// installShim writes a shim called name that execs argv. There must not
+// already be a program called name.
+func (c *command) installShim(name string, argv []string) {
+	path := filepath.Join(c.bin(), name)
+	fmt.Printf("Shimming %s %s %s\n", name, brightBlack("->"), blue(shellJoin(argv)))
+	if err := writeFileAtomic(path, []byte(shimScript(argv)), 0o755); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	c.logChange("install", path, "")
+	p := c.state().program(name)
+	*p = programState{
+		Pinned:    p.Pinned,
+		Mode:      modeShim,
+		Installed: stamp(),
+		Command:   argv,
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+	}
+	p.Checksum = sum
+	c.modified()
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceRoots returns the directories to search for program sources: those
+// in extra (from command-line flags), followed by those in $SIM_SOURCES, which
+// is a list like $PATH, followed by those added with sim sources add. Entries
+// can be globs like ~/src/*/bin.
+func (c *command) sourceRoots(extra []string) []string {
+	patterns := append([]string{}, extra...)
+	patterns = append(patterns, filepath.SplitList(os.Getenv("SIM_SOURCES"))...)
+	patterns = append(patterns, c.configuredSources()...)
+	var roots []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		for _, dir := range c.expandSource(pattern) {
+			if !seen[dir] {
+				seen[dir] = true
+				roots = append(roots, dir)
+			}
+		}
+	}
+	return roots
+}
+
+// expandSource returns the directories that a source root pattern matches.
+func (c *command) expandSource(pattern string) []string {
+	if pattern == "" {
+		return nil
+	}
+	matches, err := filepath.Glob(c.abs(c.localPath(pattern)))
+	if err != nil {
+		c.fatal("%s: %s", pattern, err)
+	}
+	var dirs []string
+	for _, dir := range matches {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// sourcesFile is where sim sources stores source roots, one per line.
+func (c *command) sourcesFile() string {
+	return filepath.Join(c.xdgDir("XDG_CONFIG_HOME", ".config"), "sim", "sources")
+}
+
+// configuredSources returns the source roots added with sim sources add.
+func (c *command) configuredSources() []string {
+	data, err := os.ReadFile(c.sourcesFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		c.fatal("%s", err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// saveSources writes the list of configured source roots.
+func (c *command) saveSources(patterns []string) {
+	var b strings.Builder
+	for _, pattern := range patterns {
+		b.WriteString(pattern)
+		b.WriteByte('\n')
+	}
+	if err := writeFileAtomic(c.sourcesFile(), []byte(b.String()), 0o644); err != nil {
+		c.fatal("%s", err)
+	}
+}
+
+func (c *command) sources(opts *options) {
+	sub, _ := opts.shift()
+	switch sub {
+	case "", "list":
+		c.validate(opts, noArgs)
+		c.listSources()
+	case "add":
+		c.validate(opts, atLeastOneArg)
+		c.addSources(opts.args)
+	case "remove", "rm":
+		c.validate(opts, atLeastOneArg)
+		c.removeSources(opts.args)
+	default:
+		c.fatal("%s: %s: unknown subcommand (expected list, add, or remove)", c.name, sub)
+	}
+}
+
+func (c *command) listSources() {
+	type entry struct{ pattern, from string }
+	var entries []entry
+	for _, pattern := range filepath.SplitList(os.Getenv("SIM_SOURCES")) {
+		if pattern != "" {
+			entries = append(entries, entry{pattern, "$SIM_SOURCES"})
+		}
+	}
+	for _, pattern := range c.configuredSources() {
+		entries = append(entries, entry{pattern, ""})
+	}
+	if len(entries) == 0 {
+		fmt.Println("No source roots (add one with sim sources add DIR)")
+		return
+	}
+	for _, e := range entries {
+		line := e.pattern
+		if e.from != "" {
+			line += " " + brightBlack("(from "+e.from+")")
+		}
+		if len(c.expandSource(e.pattern)) == 0 {
+			line += " " + brightBlack("(no matches)")
+		}
+		fmt.Println(line)
+	}
+}
+
+// sourcePattern normalizes a source root given on the command line so that it
+// is absolute, but starts with "~/" if it is in the home directory.
+func (c *command) sourcePattern(arg string) string {
+	return c.portablePath(c.abs(c.localPath(arg)))
+}
+
+func (c *command) addSources(args []string) {
+	patterns := c.configuredSources()
+	n := len(patterns)
+	for _, arg := range args {
+		pattern := c.sourcePattern(arg)
+		if contains(patterns, pattern) {
+			fmt.Printf("Already a source root: %s\n", pattern)
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			c.error("%s: %s", arg, err)
+			continue
+		}
+		if len(c.expandSource(pattern)) == 0 {
+			c.error("%s: no such directory", arg)
+			continue
+		}
+		fmt.Printf("Adding source root %s\n", blue(pattern))
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) != n {
+		c.saveSources(patterns)
+	}
+}
+
+func (c *command) removeSources(args []string) {
+	patterns := c.configuredSources()
+	n := len(patterns)
+	for _, arg := range args {
+		// Allow removing the exact text that sim sources list printed.
+		pattern := arg
+		if !contains(patterns, pattern) {
+			pattern = c.sourcePattern(arg)
+		}
+		if !contains(patterns, pattern) {
+			c.error("%s: not a source root", arg)
+			continue
+		}
+		fmt.Printf("Removing source root %s\n", blue(pattern))
+		var kept []string
+		for _, p := range patterns {
+			if p != pattern {
+				kept = append(kept, p)
+			}
+		}
+		patterns = kept
+	}
+	if len(patterns) != n {
+		c.saveSources(patterns)
+	}
+}
+
+// walkSources calls fn for every executable regular file in roots, skipping
+// hidden directories and the bin directory. If roots overlap, it calls fn only
+// once for each file.
+func (c *command) walkSources(roots []string, fn func(path string, info fs.FileInfo)) {
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") || sameDir(path, c.bin()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !isExecutable(info.Mode()) || seen[path] {
+				return nil
+			}
+			seen[path] = true
+			fn(path, info)
+			return nil
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The help messages are the source of truth for what commands and flags exist.
+// The functions in this file parse them for shell completion and man pages.
+
+// commandSpec describes a command listed in sim help.
+type commandSpec struct {
+	Name    string
+	Aliases []string
+	Summary string
+}
+
+// flagSpec describes a flag listed in a command's help.
+type flagSpec struct {
+	// Short name without the dash, or "" if there is none.
+	Short string
+	// Long name without the dashes.
+	Long string
+	// Placeholder for the flag's argument, or "" if it takes none.
+	Arg         string
+	Description string
+}
+
+// helpText returns the output of usage, using "sim" as the program name.
+func helpText(usage func(io.Writer)) string {
+	var b strings.Builder
+	usage(&b)
+	return strings.Replace(b.String(), "Usage: "+os.Args[0], "Usage: sim", 1)
+}
+
+// helpSection returns the lines of a section like "Options:" in a help
+// message, with the common indentation intact.
+func helpSection(text, heading string) []string {
+	i := strings.Index(text, "\n"+heading+"\n")
+	if i == -1 {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(text[i+len(heading)+2:], "\n") {
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var commandLineRegexp = regexp.MustCompile(`^    (?:(\S+), )?(\S+)\s+(.*)$`)
+
+// commandSpecs returns all commands in the order that sim help lists them.
+func commandSpecs() []commandSpec {
+	var specs []commandSpec
+	for _, line := range helpSection(helpText(usage), "Commands:") {
+		m := commandLineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		spec := commandSpec{Name: m[2], Summary: m[3]}
+		if m[1] != "" {
+			spec.Aliases = []string{m[1]}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+var flagLineRegexp = regexp.MustCompile(`^    (?:-(\w), )?--([\w-]+)(?: ([A-Z][A-Z-]*))?(?:\s+(.*))?$`)
+
+// flagSpecs returns the flags that a command accepts.
+func flagSpecs(name string) []flagSpec {
+	usage, ok := usageFor(name)
+	if !ok {
+		return nil
+	}
+	var specs []flagSpec
+	for _, line := range helpSection(helpText(usage), "Options:") {
+		if m := flagLineRegexp.FindStringSubmatch(line); m != nil {
+			specs = append(specs, flagSpec{Short: m[1], Long: m[2], Arg: m[3], Description: m[4]})
+		} else if len(specs) > 0 {
+			// Continuation of a description that did not fit.
+			last := &specs[len(specs)-1]
+			last.Description = strings.TrimSpace(last.Description + " " + strings.TrimSpace(line))
+		}
+	}
+	return specs
+}
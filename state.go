@@ -0,0 +1,226 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// state is metadata that sim keeps about programs in $XDG_BIN_HOME. It is
+// stored as JSON in $XDG_STATE_HOME/sim/state.json.
+type state struct {
+	// Map from program basenames to their metadata.
+	Programs map[string]*programState `json:"programs,omitempty"`
+	// Map from basenames of broken symlinks to when sim prune or sim doctor
+	// first found them broken. This includes programs sim does not manage.
+	Broken map[string]time.Time `json:"broken,omitempty"`
+}
+
+// programState is the metadata for a single program.
+type programState struct {
+	// Whether the program is protected from bulk removal.
+	Pinned bool `json:"pinned,omitempty"`
+	// How the program was installed: modeSymlink, modeCopy, modeMove, or
+	// modeShim.
+	Mode string `json:"mode,omitempty"`
+	// Absolute path the program was copied from, if any.
+	Origin string `json:"origin,omitempty"`
+	// When the program was installed.
+	Installed *time.Time `json:"installed,omitempty"`
+	// Absolute paths of associated files like man pages and completions.
+	Resources []string `json:"resources,omitempty"`
+	// SHA-256 of the installed file, for copies and moves.
+	Checksum string `json:"checksum,omitempty"`
+	// SHA-256 of the symlink's target when it was installed, for symlinks.
+	TargetChecksum string `json:"targetChecksum,omitempty"`
+	// Name of the program this is an alias of, if any.
+	Original string `json:"original,omitempty"`
+	// Version that was active before the last sim switch, for sim rollback.
+	Previous string `json:"previous,omitempty"`
+	// Command line that the program execs, for shims.
+	Command []string `json:"command,omitempty"`
+	// When the program was last run with sim exec.
+	LastRun *time.Time `json:"lastRun,omitempty"`
+}
+
+// Install modes recorded in programState.
+const (
+	modeSymlink = "symlink"
+	modeCopy    = "copy"
+	modeMove    = "move"
+	modeShim    = "shim"
+)
+
+// lookup returns the metadata for a program, or nil if there is none.
+func (s *state) lookup(name string) *programState {
+	return s.Programs[name]
+}
+
+// program returns the metadata for a program, creating it if necessary.
+func (s *state) program(name string) *programState {
+	if s.Programs == nil {
+		s.Programs = make(map[string]*programState)
+	}
+	p, ok := s.Programs[name]
+	if !ok {
+		p = &programState{}
+		s.Programs[name] = p
+	}
+	return p
+}
+
+// stamp returns the current time for recording in a programState.
+func stamp() *time.Time {
+	now := time.Now()
+	return &now
+}
+
+func (p *programState) pinned() bool {
+	return p != nil && p.Pinned
+}
+
+func (p *programState) original() string {
+	if p == nil {
+		return ""
+	}
+	return p.Original
+}
+
+func (p *programState) previous() string {
+	if p == nil {
+		return ""
+	}
+	return p.Previous
+}
+
+func (c *command) stateHome() string {
+	return c.xdgDir("XDG_STATE_HOME", ".local", "state")
+}
+
+func (c *command) stateFile() string {
+	return filepath.Join(c.stateHome(), "sim", "state.json")
+}
+
+// state loads the state file, or returns the already loaded state.
+func (c *command) state() *state {
+	if c.st != nil {
+		return c.st
+	}
+	c.st = &state{}
+	data, err := os.ReadFile(c.stateFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return c.st
+	} else if err != nil {
+		c.fatal("reading state: %s", err)
+	}
+	if err := json.Unmarshal(data, c.st); err != nil {
+		c.fatal("%s: %s", c.stateFile(), err)
+	}
+	return c.st
+}
+
+// brokenSince returns when a program was first found to be a broken symlink,
+// or now if this is the first time. If record is true, it records that time.
+func (c *command) brokenSince(name string, record bool) time.Time {
+	if since, ok := c.state().Broken[name]; ok {
+		return since
+	}
+	now := time.Now()
+	if record {
+		if c.st.Broken == nil {
+			c.st.Broken = make(map[string]time.Time)
+		}
+		c.st.Broken[name] = now
+		c.modified()
+	}
+	return now
+}
+
+// markWorking records that a program is not a broken symlink.
+func (c *command) markWorking(name string) {
+	if _, ok := c.state().Broken[name]; ok {
+		delete(c.st.Broken, name)
+		c.modified()
+	}
+}
+
+// modified marks the state as needing to be saved.
+func (c *command) modified() {
+	c.state()
+	c.stateDirty = true
+	c.dir = nil
+}
+
+// forget removes all metadata for a program.
+func (c *command) forget(name string) {
+	if c.state().lookup(name) != nil {
+		delete(c.st.Programs, name)
+		c.modified()
+	}
+	c.markWorking(name)
+}
+
+// saveState writes the state file if it was modified.
+func (c *command) saveState() {
+	if !c.stateDirty {
+		return
+	}
+	data, err := json.MarshalIndent(c.st, "", "\t")
+	if err != nil {
+		c.fatal("encoding state: %s", err)
+	}
+	if err := writeFileAtomic(c.stateFile(), append(data, '\n'), 0o644); err != nil {
+		c.fatal("writing state: %s", err)
+	}
+	c.stateDirty = false
+}
+
+// writeFileAtomic writes a file by renaming a temporary file over it, creating
+// parent directories as needed.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// checksum returns the hex-encoded SHA-256 of the file at path.
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+func (c *command) stats(opts *options) {
+	c.validate(opts, noArgs)
+	var programs, symlinks, files, broken, aliases, pinned int
+	var fileSize int64
+	targetDirs := make(map[string]bool)
+	var latestName string
+	var latest time.Time
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		programs++
+		name := file.Name()
+		path := filepath.Join(c.bin(), name)
+		p := c.state().lookup(name)
+		if p.original() != "" {
+			aliases++
+		}
+		if p.pinned() {
+			pinned++
+		}
+		installed := time.Time{}
+		if p != nil && p.Installed != nil {
+			installed = *p.Installed
+		}
+		if isSymlink(file.Type()) {
+			symlinks++
+			if relOrAbsTarget, err := os.Readlink(path); err == nil {
+				targetDirs[filepath.Dir(ensureAbs(c.bin(), relOrAbsTarget))] = true
+			}
+			if _, err := os.Stat(path); err != nil {
+				broken++
+			}
+		} else if info, err := file.Info(); err == nil {
+			files++
+			fileSize += info.Size()
+			if installed.IsZero() {
+				installed = info.ModTime()
+			}
+		}
+		if installed.After(latest) {
+			latest, latestName = installed, name
+		}
+	}
+	field := func(key, format string, args ...interface{}) {
+		fmt.Printf("%-19s %s\n", key+":", fmt.Sprintf(format, args...))
+	}
+	field("Programs", "%d", programs)
+	field("Symlinks", "%d", symlinks)
+	field("Files", "%d (%s)", files, formatSize(fileSize))
+	field("Broken symlinks", "%d", broken)
+	field("Aliases", "%d", aliases)
+	field("Pinned", "%d", pinned)
+	field("Target directories", "%d", len(targetDirs))
+	if latestName != "" {
+		field("Latest install", "%s (%s)", latestName, latest.Format("2006-01-02 15:04"))
+	}
+}
+
+func (c *command) du(opts *options) {
+	c.validate(opts, noArgs)
+	type usage struct {
+		name     string
+		size     int64
+		programs int
+	}
+	var copies []usage
+	projects := make(map[string]*usage)
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		path := filepath.Join(c.bin(), file.Name())
+		if !isSymlink(file.Type()) {
+			if info, err := file.Info(); err == nil {
+				copies = append(copies, usage{name: file.Name(), size: info.Size()})
+			}
+			continue
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			continue
+		}
+		dir := projectDir(target, c.home())
+		u, ok := projects[dir]
+		if !ok {
+			u = &usage{name: dir}
+			projects[dir] = u
+		}
+		u.size += info.Size()
+		u.programs++
+	}
+	var targets []usage
+	for _, u := range projects {
+		targets = append(targets, *u)
+	}
+	for _, list := range [][]usage{copies, targets} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].size != list[j].size {
+				return list[i].size > list[j].size
+			}
+			return naturalLess(list[i].name, list[j].name)
+		})
+	}
+	var total int64
+	for _, u := range copies {
+		total += u.size
+	}
+	fmt.Printf("Files in %s: %s\n", c.bin(), formatSize(total))
+	for _, u := range copies {
+		fmt.Printf("    %10s  %s\n", formatSize(u.size), u.name)
+	}
+	total = 0
+	for _, u := range targets {
+		total += u.size
+	}
+	fmt.Printf("Symlink targets by project: %s\n", formatSize(total))
+	for _, u := range targets {
+		noun := "programs"
+		if u.programs == 1 {
+			noun = "program"
+		}
+		fmt.Printf("    %10s  %s %s\n", formatSize(u.size), blue(u.name), brightBlack(fmt.Sprintf("(%d %s)", u.programs, noun)))
+	}
+}
+
+// projectMarkers are files that indicate the root of a project.
+var projectMarkers = []string{
+	".git", ".hg", "go.mod", "Cargo.toml", "package.json", "pyproject.toml", "Makefile",
+}
+
+// projectDir returns the root of the project containing path, found by
+// looking for projectMarkers in its ancestors up to home. If there is none,
+// it returns the directory containing path.
+func projectDir(path, home string) string {
+	for dir := filepath.Dir(path); isUnder(dir, home) && dir != home; dir = filepath.Dir(dir) {
+		for _, marker := range projectMarkers {
+			if _, err := os.Lstat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+	}
+	return filepath.Dir(path)
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Versioned programs are installed as NAME-VERSION, where VERSION starts with a
+// digit (optionally preceded by "v"). The switch command makes NAME a symlink to
+// one of them.
+
+func (c *command) switchVersion(opts *options) {
+	force := opts.bool('f', "force")
+	c.validate(opts, atLeastOneArg)
+	if len(opts.args) > 2 {
+		c.fatal("%s: too many arguments", c.name)
+	}
+	name := opts.args[0]
+	versions := c.versions(name)
+	if len(versions) == 0 {
+		c.fatal("%s: no versions installed (install them as %s-VERSION)", name, name)
+	}
+	active := c.activeVersion(name)
+	if len(opts.args) == 1 {
+		for _, version := range versions {
+			if version == active {
+				fmt.Printf("%s %s\n", version, brightBlack("(active)"))
+			} else {
+				fmt.Println(version)
+			}
+		}
+		return
+	}
+	version := opts.args[1]
+	if !contains(versions, version) {
+		c.fatal("%s: version %s not installed (available: %s)", name, version, strings.Join(versions, ", "))
+	}
+	if version == active {
+		fmt.Printf("%s is already at %s\n", name, version)
+		return
+	}
+	c.switchTo(name, version, active, force)
+}
+
+// switchTo makes a program a symlink to one of its versions, replacing the
+// active version (or a non-versioned program if force is true).
+func (c *command) switchTo(name, version, active string, force bool) {
+	path := filepath.Join(c.bin(), name)
+	target := name + "-" + version
+	info, err := os.Lstat(path)
+	if err == nil {
+		if active == "" && !force {
+			c.fatal("%s: exists and is not a symlink to a version (replace it with --force)", name)
+		}
+		if isSymlink(info.Mode()) {
+			// Replaced atomically below.
+			c.logChange("remove", path, linkTarget(path))
+		} else if err := c.overwrite(path); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		c.fatal("%s: %s", name, err)
+	}
+	fmt.Printf("Switching %s %s %s\n", name, brightBlack("->"), target)
+	if err := replaceSymlink(target, path); err != nil {
+		c.fatal("%s: %s", name, err)
+	}
+	c.logChange("install", path, filepath.Join(c.bin(), target))
+	p := c.state().program(name)
+	*p = programState{Pinned: p.Pinned, Mode: modeSymlink, Installed: stamp(), Original: target, Previous: active}
+	c.modified()
+}
+
+// versions returns the installed versions of a program in natural order.
+func (c *command) versions(name string) []string {
+	var versions []string
+	prefix := name + "-"
+	for _, file := range c.files() {
+		if skip(file) || !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+		if version := strings.TrimPrefix(file.Name(), prefix); isVersion(version) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return naturalLess(versions[i], versions[j])
+	})
+	return versions
+}
+
+// activeVersion returns the version that a program is a symlink to, or "" if
+// it is not a symlink to one of its versions.
+func (c *command) activeVersion(name string) string {
+	target := linkTarget(filepath.Join(c.bin(), name))
+	if filepath.Dir(target) != "." {
+		return ""
+	}
+	version := strings.TrimPrefix(target, name+"-")
+	if version == target || !isVersion(version) {
+		return ""
+	}
+	return version
+}
+
+// isVersion returns true if s looks like a version, such as 1.22.1 or v2.
+func isVersion(s string) bool {
+	s = strings.TrimPrefix(s, "v")
+	return s != "" && isDigit(s[0])
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *command) rollback(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		c.rollbackProgram(name)
+	}
+}
+
+// rollbackProgram switches a program back to the version that was active
+// before the last switch. Rolling back twice returns to the original version.
+func (c *command) rollbackProgram(name string) {
+	previous := c.state().lookup(name).previous()
+	if previous == "" {
+		c.error("%s: no previous version (see sim switch %s)", name, name)
+		return
+	}
+	if !contains(c.versions(name), previous) {
+		c.error("%s: previous version %s is no longer installed", name, previous)
+		return
+	}
+	active := c.activeVersion(name)
+	if active == "" {
+		c.error("%s: not a symlink to a version (use sim switch --force)", name)
+		return
+	}
+	c.switchTo(name, previous, active, false)
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func (c *command) sync(opts *options) {
+	pull := opts.bool('p', "pull")
+	file := opts.string('f', "file")
+	message := opts.string('m', "message")
+	c.validate(opts, noArgs)
+	if file == "" {
+		if file = os.Getenv("SIM_MANIFEST"); file == "" {
+			c.fatal("%s: no manifest (use --file or set $SIM_MANIFEST)", c.name)
+		}
+	}
+	if message == "" {
+		message = "Update sim manifest"
+	}
+	file = c.abs(c.localPath(file))
+	dir := filepath.Dir(file)
+	if _, err := gitOutput(dir, "rev-parse", "--git-dir"); err != nil {
+		c.fatal("%s: not in a git repository", dir)
+	}
+	if pull {
+		fmt.Printf("Pulling %s\n", blue(dir))
+		if err := git(dir, "pull", "--ff-only"); err != nil {
+			c.fatal("%s: git pull: %s", dir, err)
+		}
+		if _, err := os.Stat(file); err == nil {
+			c.installEntries(c.readManifest(file))
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			c.fatal("%s", err)
+		}
+	}
+	c.writeManifest(file, c.manifest())
+	status, err := gitOutput(dir, "status", "--porcelain", "--", file)
+	if err != nil {
+		c.fatal("%s: git status: %s", dir, err)
+	}
+	if len(status) == 0 {
+		fmt.Printf("%s is up to date\n", blue(file))
+		return
+	}
+	fmt.Printf("Committing %s\n", blue(file))
+	if err := git(dir, "add", "--", file); err != nil {
+		c.fatal("%s: git add: %s", dir, err)
+	}
+	if err := git(dir, "commit", "--quiet", "-m", message, "--", file); err != nil {
+		c.fatal("%s: git commit: %s", dir, err)
+	}
+}
+
+// git runs a git command in dir, showing its output.
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// gitOutput runs a git command in dir and returns its output.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	return exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// trash moves the file at path to the trash. On macOS it uses ~/.Trash, and
+// elsewhere it follows the FreeDesktop.org Trash specification.
+func (c *command) trash(path string) error {
+	if runtime.GOOS == "darwin" {
+		dir := filepath.Join(c.home(), ".Trash")
+		dest, err := reserve(dir, filepath.Base(path), "", nil)
+		if err != nil {
+			return err
+		}
+		return moveFile(path, dest)
+	}
+	dir := filepath.Join(c.dataHome(), "Trash")
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+	info := fmt.Sprintf(
+		"[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: path}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"),
+	)
+	infoPath, err := reserve(filepath.Join(dir, "info"), filepath.Base(path), ".trashinfo", []byte(info))
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(infoPath), ".trashinfo")
+	if err := moveFile(path, filepath.Join(dir, "files", name)); err != nil {
+		os.Remove(infoPath)
+		return err
+	}
+	return nil
+}
+
+// reserve finds an unused name in dir based on name and returns its path. If
+// content is non-nil, it also atomically creates the file with that content.
+func reserve(dir, name, ext string, content []byte) (string, error) {
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s.%d", name, i)
+		}
+		path := filepath.Join(dir, candidate+ext)
+		if content == nil {
+			if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+				return path, nil
+			} else if err != nil {
+				return "", err
+			}
+			continue
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		_, err = f.Write(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// moveFile renames src to dst, falling back to copying and removing if they
+// are on different devices. Symlinks are moved as symlinks.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !isCrossDevice(err) {
+		return err
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if isSymlink(info.Mode()) {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	} else if err := exec.Command("cp", "-p", src, dst).Run(); err != nil {
+		return fmt.Errorf("copying file: %w", err)
+	}
+	return os.Remove(src)
+}
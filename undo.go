@@ -0,0 +1,255 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// undoDir is where sim moves regular files it removes, so that sim undo can
+// restore them.
+func (c *command) undoDir() string {
+	return filepath.Join(c.stateHome(), "sim", "undo")
+}
+
+// stash moves the file at path into the undo directory and returns its new
+// path.
+func (c *command) stash(path string) (string, error) {
+	return backupFile(c.undoDir(), path)
+}
+
+// overwrite removes the program at path so that it can be replaced, if there is
+// one. Regular files are stashed so that sim undo can restore them.
+func (c *command) overwrite(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	target := linkTarget(path)
+	var backup string
+	var err error
+	if target == "" {
+		backup, err = c.stash(path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return err
+	}
+	c.logBackup("remove", path, target, backup)
+	return nil
+}
+
+func (c *command) undo(opts *options) {
+	force := opts.bool('f', "force")
+	dryRun := opts.bool('n', "dry-run")
+	c.validate(opts, noArgs)
+	entry, retry, ok := c.lastUndoable()
+	if !ok {
+		c.fatal("%s: nothing to undo", c.name)
+	}
+	command := strings.Join(append([]string{"sim"}, entry.Args...), " ")
+	for _, ch := range entry.Changes {
+		switch ch.Action {
+		case "install", "remove", "forget", "restore":
+		default:
+			c.fatal("%s: cannot undo %s (%s %s)", c.name, command, ch.Action, filepath.Base(ch.Path))
+		}
+	}
+	verb := "Undoing"
+	if dryRun {
+		verb = "Would undo"
+	}
+	fmt.Printf("%s %s %s\n", verb, command, brightBlack(entry.Time.Local().Format("(2006-01-02 15:04:05)")))
+	failed := c.failed
+	var attempted int
+	var stepFailed []int
+	for i := len(entry.Changes) - 1; i >= 0; i-- {
+		if retry != nil && !retry[i] {
+			continue
+		}
+		ch := entry.Changes[i]
+		attempted++
+		c.failed = false
+		switch ch.Action {
+		case "install", "restore":
+			c.undoInstall(ch, force, dryRun)
+		case "remove":
+			c.undoRemove(ch, dryRun)
+		case "forget":
+			fmt.Printf("    Restoring metadata for %s\n", filepath.Base(ch.Path))
+			if !dryRun {
+				c.logChange("restore", ch.Path, "")
+				c.restoreState(ch)
+			}
+		}
+		if c.failed {
+			stepFailed = append(stepFailed, i)
+			failed = true
+		}
+	}
+	c.failed = failed
+	if !dryRun {
+		// If nothing was reversed, there is no journal entry and the whole
+		// command stays undoable. Otherwise, the failed steps are recorded so
+		// that the next sim undo retries only those.
+		c.undid = &entry.Time
+		c.undoFailed = stepFailed
+	}
+	if !dryRun && len(stepFailed) > 0 {
+		fmt.Printf(
+			"Undid %d of %d changes %s\n", attempted-len(stepFailed), attempted,
+			brightBlack("(run sim undo again to retry the rest)"),
+		)
+	}
+}
+
+// lastUndoable returns the most recent journal entry that is not from sim undo
+// and has not been fully undone. If it was partly undone, it also returns the
+// indexes of the changes that still need to be undone.
+func (c *command) lastUndoable() (journalEntry, map[int]bool, bool) {
+	entries := c.readJournal()
+	// Changes left to undo by time of entry, or nil if it was fully undone.
+	undone := make(map[int64]map[int]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Undid != nil {
+			key := entry.Undid.UnixNano()
+			// Only the latest undo of an entry counts, since it only retried
+			// the changes that earlier ones failed to undo.
+			if _, ok := undone[key]; ok {
+				continue
+			}
+			var retry map[int]bool
+			for _, n := range entry.Failed {
+				if retry == nil {
+					retry = make(map[int]bool)
+				}
+				retry[n] = true
+			}
+			undone[key] = retry
+			continue
+		}
+		retry, ok := undone[entry.Time.UnixNano()]
+		if !ok || retry != nil {
+			return entry, retry, true
+		}
+	}
+	return journalEntry{}, nil, false
+}
+
+// undoInstall removes an installed or restored program, or moves it back to
+// where it came from if it was installed with --move.
+func (c *command) undoInstall(ch change, force, dryRun bool) {
+	name := filepath.Base(ch.Path)
+	info, err := os.Lstat(ch.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.error("%s: no longer installed", name)
+		return
+	} else if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	p := c.state().lookup(name)
+	if !force && c.changedSince(ch, info, p) {
+		c.error("%s: changed since it was installed (undo anyway with --force)", name)
+		return
+	}
+	if ch.Action == "install" && p != nil && p.Mode == modeMove {
+		fmt.Printf("    Moving %s back to %s\n", name, blue(ch.Target))
+		if dryRun {
+			return
+		}
+		if _, err := os.Lstat(ch.Target); err == nil {
+			c.error("%s: %s exists", name, ch.Target)
+			return
+		}
+		if err := moveFile(ch.Path, ch.Target); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+	} else {
+		fmt.Printf("    Removing %s\n", name)
+		if dryRun {
+			return
+		}
+		if err := os.Remove(ch.Path); err != nil {
+			c.error("%s: %s", name, err)
+			return
+		}
+	}
+	c.logChange("remove", ch.Path, ch.Target)
+	c.restoreState(ch)
+}
+
+// changedSince returns true if the program at ch.Path is no longer what the
+// install change put there.
+func (c *command) changedSince(ch change, info fs.FileInfo, p *programState) bool {
+	if isSymlink(info.Mode()) {
+		target := linkTarget(ch.Path)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(ch.Path), target)
+		}
+		return filepath.Clean(target) != ch.Target
+	}
+	if p == nil || p.Checksum == "" {
+		return false
+	}
+	sum, err := checksum(ch.Path)
+	return err != nil || sum != p.Checksum
+}
+
+// undoRemove restores a removed program, either by recreating its symlink or
+// by moving it back from the undo directory.
+func (c *command) undoRemove(ch change, dryRun bool) {
+	name := filepath.Base(ch.Path)
+	if _, err := os.Lstat(ch.Path); err == nil {
+		c.error("%s: exists", name)
+		return
+	}
+	if ch.Target == "" && ch.Backup == "" {
+		c.error("%s: no backup to restore", name)
+		return
+	}
+	if ch.Target != "" {
+		fmt.Printf("    Restoring %s %s %s\n", name, brightBlack("->"), blue(ch.Target))
+	} else {
+		fmt.Printf("    Restoring %s %s %s\n", name, brightBlack("from"), blue(ch.Backup))
+	}
+	if dryRun {
+		return
+	}
+	var err error
+	if ch.Target != "" {
+		err = os.Symlink(ch.Target, ch.Path)
+	} else {
+		err = moveFile(ch.Backup, ch.Path)
+	}
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	c.logChange("restore", ch.Path, ch.Target)
+	c.restoreState(ch)
+}
+
+// restoreState sets a program's metadata back to what it was before a change.
+// It does nothing for files outside the bin directory, like resources.
+func (c *command) restoreState(ch change) {
+	if filepath.Dir(ch.Path) != c.bin() {
+		return
+	}
+	name := filepath.Base(ch.Path)
+	if ch.State == nil {
+		c.forget(name)
+		return
+	}
+	*c.state().program(name) = *ch.State
+	c.modified()
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoInstall(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	link := filepath.Join(home, "bin", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", src) {
+		t.Fatal("install failed")
+	}
+	if !runSim(t, "undo") {
+		t.Fatal("undo failed")
+	}
+	if exists(link) {
+		t.Error("undo did not remove foo")
+	}
+	if loadState(t).lookup("foo") != nil {
+		t.Error("undo did not forget foo")
+	}
+	if !exists(src) {
+		t.Error("undo removed the source")
+	}
+	if runSim(t, "undo") {
+		t.Error("undo succeeded with nothing to undo")
+	}
+}
+
+func TestUndoRemoveCopy(t *testing.T) {
+	home := testEnv(t)
+	src := filepath.Join(home, "src", "foo")
+	path := filepath.Join(home, "bin", "foo")
+	writeScript(t, src, "foo")
+	if !runSim(t, "install", "--copy", src) {
+		t.Fatal("install failed")
+	}
+	want := *loadState(t).lookup("foo")
+	if !runSim(t, "remove", "foo") {
+		t.Fatal("remove failed")
+	}
+	if exists(path) {
+		t.Fatal("remove did not remove foo")
+	}
+	if !runSim(t, "undo") {
+		t.Fatal("undo failed")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "#!/bin/sh\necho foo\n" {
+		t.Errorf("undo restored %q", data)
+	}
+	if got := loadState(t).lookup("foo"); got == nil || got.Checksum != want.Checksum {
+		t.Errorf("undo restored state %+v, want %+v", got, want)
+	}
+	// The next undo goes back to before the install.
+	if !runSim(t, "undo") {
+		t.Fatal("second undo failed")
+	}
+	if exists(path) {
+		t.Error("second undo did not remove foo")
+	}
+}
+
+func TestUndoPartialFailure(t *testing.T) {
+	home := testEnv(t)
+	foo := filepath.Join(home, "src", "foo")
+	bar := filepath.Join(home, "src", "bar")
+	writeScript(t, foo, "foo")
+	writeScript(t, bar, "bar")
+	if !runSim(t, "install", foo, bar) {
+		t.Fatal("install failed")
+	}
+	// Point foo somewhere else so that undoing its install fails.
+	link := filepath.Join(home, "bin", "foo")
+	other := filepath.Join(home, "src", "other")
+	writeScript(t, other, "other")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(other, link); err != nil {
+		t.Fatal(err)
+	}
+	if runSim(t, "undo") {
+		t.Error("undo succeeded although foo changed")
+	}
+	if exists(filepath.Join(home, "bin", "bar")) {
+		t.Error("undo did not remove bar")
+	}
+	if !exists(link) {
+		t.Error("undo removed foo although it changed")
+	}
+	c := command{}
+	entry, retry, ok := c.lastUndoable()
+	if !ok {
+		t.Fatal("install is no longer undoable after a failed undo")
+	}
+	if len(retry) != 1 || entry.Changes[firstKey(retry)].Path != link {
+		t.Errorf("undo will retry %v of %+v, want only foo", retry, entry.Changes)
+	}
+	if !runSim(t, "undo", "--force") {
+		t.Fatal("undo --force failed")
+	}
+	if exists(link) {
+		t.Error("undo --force did not remove foo")
+	}
+	if _, _, ok := c.lastUndoable(); ok {
+		t.Error("install is still undoable after undoing every change")
+	}
+}
+
+// firstKey returns an arbitrary key of a non-empty set.
+func firstKey(set map[int]bool) int {
+	for k := range set {
+		return k
+	}
+	return -1
+}
@@ -0,0 +1,11 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+
+package main
+
+// isUnreachableErrno returns false since these systems do not report
+// unavailable network filesystems with errnos. Only timeouts are detected.
+func isUnreachableErrno(err error) bool {
+	return false
+}
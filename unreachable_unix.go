@@ -0,0 +1,24 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isUnreachableErrno returns true if err has an errno that network
+// filesystems return when the server is unavailable.
+func isUnreachableErrno(err error) bool {
+	for _, errno := range []syscall.Errno{
+		syscall.EIO, syscall.ESTALE, syscall.ETIMEDOUT,
+		syscall.EHOSTDOWN, syscall.EHOSTUNREACH, syscall.ENOTCONN,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
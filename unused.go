@@ -0,0 +1,99 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// unusedRecord describes a program that has not been run recently.
+type unusedRecord struct {
+	Name string `json:"name"`
+	// When the program was last run, or nil if it is not known.
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+func (c *command) unused(opts *options) {
+	since := opts.string('s', "since")
+	json := opts.bool('j', "json")
+	c.validate(opts, noArgs)
+	if since == "" {
+		since = "90d"
+	}
+	period, err := parseDuration(since)
+	if err != nil {
+		c.fatal("%s: --since: %s", c.name, err)
+	}
+	cutoff := time.Now().Add(-period)
+	records := []unusedRecord{}
+	for _, file := range c.files() {
+		if skip(file) {
+			continue
+		}
+		name := file.Name()
+		p := c.state().lookup(name)
+		// Programs installed recently have not had a chance to be used.
+		if p != nil && p.Installed != nil && p.Installed.After(cutoff) {
+			continue
+		}
+		lastUsed, ok := c.lastUsed(name)
+		if ok && lastUsed.After(cutoff) {
+			continue
+		}
+		r := unusedRecord{Name: name}
+		if ok {
+			r.LastUsed = &lastUsed
+		}
+		records = append(records, r)
+	}
+	// Show programs that were used longest ago first.
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i].LastUsed, records[j].LastUsed
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	if json {
+		printJSON(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Printf("All programs were used in the last %s\n", since)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROGRAM\tLAST USED")
+	for _, r := range records {
+		when := "unknown"
+		if r.LastUsed != nil {
+			when = r.LastUsed.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\n", r.Name, when)
+	}
+	w.Flush()
+}
+
+// lastUsed returns when a program was last run, using the later of the time it
+// was last run with sim exec and the time recorded by the sim init --track
+// hook. It returns false if neither is available.
+func (c *command) lastUsed(name string) (time.Time, bool) {
+	var last time.Time
+	if p := c.state().lookup(name); p != nil && p.LastRun != nil {
+		last = *p.LastRun
+	}
+	if info, err := os.Stat(filepath.Join(c.usedDir(), name)); err == nil && info.ModTime().After(last) {
+		last = info.ModTime()
+	}
+	return last, !last.IsZero()
+}
+
+// usedDir is where the sim init --track hook records when programs are run.
+func (c *command) usedDir() string {
+	return filepath.Join(c.stateHome(), "sim", "used")
+}
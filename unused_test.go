@@ -0,0 +1,56 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastUsed(t *testing.T) {
+	home := testEnv(t)
+	for _, name := range []string{"foo", "bar", "baz"} {
+		src := filepath.Join(home, "src", name)
+		writeScript(t, src, name)
+		if !runSim(t, "install", src) {
+			t.Fatalf("installing %s failed", name)
+		}
+	}
+	// Reading a program must not count as using it.
+	if _, err := os.ReadFile(filepath.Join(home, "bin", "foo")); err != nil {
+		t.Fatal(err)
+	}
+	c := command{}
+	ran := time.Now().Add(-time.Hour).Truncate(time.Second)
+	c.state().program("bar").LastRun = &ran
+	tracked := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := os.MkdirAll(c.usedDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bar", "baz"} {
+		path := filepath.Join(c.usedDir(), name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, tracked, tracked); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.state().program("baz").LastRun = stamp()
+	for _, tc := range []struct {
+		name string
+		want time.Time
+		ok   bool
+	}{
+		{"foo", time.Time{}, false},
+		{"bar", tracked, true},
+		{"baz", *c.state().lookup("baz").LastRun, true},
+	} {
+		got, ok := c.lastUsed(tc.name)
+		if ok != tc.ok || !got.Equal(tc.want) {
+			t.Errorf("lastUsed(%q) = %s, %t, want %s, %t", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+func (c *command) update(opts *options) {
+	dryRun := opts.bool('n', "dry-run")
+	c.validate(opts, anyArgs)
+	for _, name := range c.copies(opts.args) {
+		c.updateProgram(name, dryRun)
+	}
+}
+
+// copies returns the names of programs installed with --copy whose origin is
+// recorded. If names is empty, it returns all of them in sorted order.
+// Otherwise it returns the given names, reporting errors for invalid ones.
+func (c *command) copies(names []string) []string {
+	if len(names) == 0 {
+		for name, p := range c.state().Programs {
+			if p.Mode == modeCopy && p.Origin != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+		return names
+	}
+	var valid []string
+	for _, name := range names {
+		p := c.state().lookup(name)
+		if p == nil {
+			c.error("%s: not installed by sim", name)
+		} else if p.Mode != modeCopy || p.Origin == "" {
+			c.error("%s: not a copy with a recorded origin", name)
+		} else {
+			valid = append(valid, name)
+		}
+	}
+	return valid
+}
+
+// updateProgram re-copies a program from its origin if the content differs.
+func (c *command) updateProgram(name string, dryRun bool) {
+	p := c.state().lookup(name)
+	path := filepath.Join(c.bin(), name)
+	newSum, err := checksum(p.Origin)
+	if err != nil {
+		c.error("%s: origin: %s", name, err)
+		return
+	}
+	oldSum, err := checksum(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	if newSum == oldSum {
+		return
+	}
+	if dryRun {
+		fmt.Printf("Would update %s %s %s\n", name, brightBlack("from"), blue(p.Origin))
+		return
+	}
+	fmt.Printf("Updating %s %s %s\n", name, brightBlack("from"), blue(p.Origin))
+	if err := replaceWithCopy(p.Origin, path); err != nil {
+		c.error("%s: %s", name, err)
+		return
+	}
+	p.Checksum = newSum
+	p.Installed = stamp()
+	c.modified()
+	c.logChange("update", path, p.Origin)
+}
+
+// replaceWithCopy atomically replaces the file at path with a copy of src.
+func replaceWithCopy(src, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	os.Remove(tmp)
+	if err := exec.Command("cp", src, tmp).Run(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (c *command) outdated(opts *options) {
+	c.validate(opts, anyArgs)
+	for _, name := range c.copies(opts.args) {
+		installed, origin, ok := c.compareOrigin(name)
+		if !ok || installed == nil {
+			continue
+		}
+		fmt.Printf(
+			"%s %s %s %s\n", name, describeFile(installed),
+			brightBlack("->"), describeFile(origin),
+		)
+	}
+}
+
+// compareOrigin stats a copied program and its origin. If their content is the
+// same, it returns nil file infos. If either cannot be read, it reports an
+// error and returns false.
+func (c *command) compareOrigin(name string) (installed, origin fs.FileInfo, ok bool) {
+	p := c.state().lookup(name)
+	path := filepath.Join(c.bin(), name)
+	installed, err := os.Stat(path)
+	if err != nil {
+		c.error("%s: %s", name, err)
+		return nil, nil, false
+	}
+	origin, err = os.Stat(p.Origin)
+	if err != nil {
+		c.error("%s: origin: %s", name, err)
+		return nil, nil, false
+	}
+	if installed.Size() == origin.Size() {
+		oldSum, err := checksum(path)
+		if err != nil {
+			c.error("%s: %s", name, err)
+			return nil, nil, false
+		}
+		newSum, err := checksum(p.Origin)
+		if err != nil {
+			c.error("%s: origin: %s", name, err)
+			return nil, nil, false
+		}
+		if oldSum == newSum {
+			return nil, nil, true
+		}
+	}
+	return installed, origin, true
+}
+
+// describeFile returns the size and modification time of a file.
+func describeFile(info fs.FileInfo) string {
+	return fmt.Sprintf("(%s, %s)", formatSize(info.Size()), info.ModTime().Format("2006-01-02 15:04"))
+}
+
+func (c *command) diff(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range c.copies(opts.args) {
+		installed, origin, ok := c.compareOrigin(name)
+		if !ok || installed == nil {
+			continue
+		}
+		c.failed = true
+		path := filepath.Join(c.bin(), name)
+		originPath := c.state().lookup(name).Origin
+		oldType, err1 := programType(path)
+		newType, err2 := programType(originPath)
+		if err1 == nil && err2 == nil && oldType != typeBinary && newType != typeBinary {
+			cmd := exec.Command("diff", "-u", path, originPath)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				if err, ok := err.(*exec.ExitError); !ok || err.ExitCode() != 1 {
+					c.error("%s: running diff: %s", name, err)
+				}
+			}
+			continue
+		}
+		fmt.Printf("%s: binaries differ\n", name)
+		for _, file := range []struct {
+			label, path string
+			info        fs.FileInfo
+		}{{"installed", path, installed}, {"origin", originPath, origin}} {
+			sum, err := checksum(file.path)
+			if err != nil {
+				c.error("%s: %s", file.path, err)
+				continue
+			}
+			fmt.Printf("    %-10s %s %s sha256:%s\n", file.label+":", blue(file.path), describeFile(file.info), sum)
+		}
+	}
+}
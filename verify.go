@@ -0,0 +1,138 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Outcomes of verifying a program.
+const (
+	verifyOK         = "ok"
+	verifyMismatch   = "mismatch"
+	verifyMissing    = "missing"
+	verifyError      = "error"
+	verifyUnrecorded = "unrecorded"
+)
+
+// verifyResult is the outcome of verifying a program's checksum.
+type verifyResult struct {
+	Name string `json:"name"`
+	// File whose content was checked: the program itself for copies and moves,
+	// or the resolved target for symlinks.
+	File     string `json:"file"`
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (c *command) verify(opts *options) {
+	links := opts.bool('l', "links")
+	json := opts.bool('j', "json")
+	c.validate(opts, anyArgs)
+	names := opts.args
+	all := len(names) == 0
+	if all {
+		for name := range c.state().Programs {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+	}
+	results := []verifyResult{}
+	var verified, failed, unverified int
+	for _, name := range names {
+		p := c.state().lookup(name)
+		if p == nil {
+			c.error("%s: not installed by sim", name)
+			continue
+		}
+		if original := p.original(); original != "" {
+			if !all {
+				c.error("%s: alias of %s (verify it instead)", name, original)
+			}
+			continue
+		}
+		if p.Mode == modeSymlink && !links {
+			if !all {
+				c.error("%s: symlink (use --links to verify its target)", name)
+			}
+			continue
+		}
+		r := c.verifyProgram(name, p)
+		if r.Status == verifyUnrecorded && all {
+			unverified++
+			continue
+		}
+		results = append(results, r)
+		switch r.Status {
+		case verifyOK:
+			verified++
+			continue
+		case verifyUnrecorded:
+			unverified++
+		default:
+			failed++
+			c.failed = true
+		}
+		if !json {
+			fmt.Fprintln(os.Stderr, r)
+		}
+	}
+	if json {
+		printJSON(results)
+		return
+	}
+	fmt.Printf("Verified %d, failed %d, unverified %d\n", verified, failed, unverified)
+}
+
+// verifyProgram compares the checksum recorded for a program with its current
+// content, or its target's content if it is a symlink.
+func (c *command) verifyProgram(name string, p *programState) verifyResult {
+	file := filepath.Join(c.bin(), name)
+	expected := p.Checksum
+	if p.Mode == modeSymlink {
+		expected = p.TargetChecksum
+		if target, err := filepath.EvalSymlinks(file); err == nil {
+			file = target
+		}
+	}
+	r := verifyResult{Name: name, File: file, Expected: expected}
+	if expected == "" {
+		r.Status = verifyUnrecorded
+		return r
+	}
+	sum, err := checksum(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		r.Status = verifyMissing
+	} else if err != nil {
+		r.Status = verifyError
+		r.Error = err.Error()
+	} else if r.Actual = sum; sum != expected {
+		r.Status = verifyMismatch
+	} else {
+		r.Status = verifyOK
+	}
+	return r
+}
+
+func (r verifyResult) String() string {
+	switch r.Status {
+	case verifyMismatch:
+		return fmt.Sprintf("%s: %s: checksum mismatch (expected %s, got %s)", r.Name, r.File, r.Expected, r.Actual)
+	case verifyMissing:
+		return fmt.Sprintf("%s: %s: file not found", r.Name, r.File)
+	case verifyError:
+		return fmt.Sprintf("%s: %s: %s", r.Name, r.File, r.Error)
+	case verifyUnrecorded:
+		return fmt.Sprintf("%s: no recorded checksum", r.Name)
+	}
+	return fmt.Sprintf("%s: %s: ok", r.Name, r.File)
+}
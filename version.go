@@ -0,0 +1,77 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version is the release version. Release builds set it with
+// -ldflags "-X main.version=1.2.3". Otherwise, it comes from the module.
+var version string
+
+// buildInfo describes how the running sim binary was built.
+type buildInfo struct {
+	Version   string
+	Commit    string
+	Modified  bool
+	Date      string
+	GoVersion string
+	Platform  string
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   strings.TrimPrefix(version, "v"),
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "" && build.Main.Version != "(devel)" {
+		info.Version = strings.TrimPrefix(build.Main.Version, "v")
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.Date = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func (c *command) version(opts *options) {
+	short := opts.bool('s', "short")
+	c.validate(opts, noArgs)
+	info := readBuildInfo()
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	if short {
+		fmt.Println(info.Version)
+		return
+	}
+	fmt.Printf("sim %s\n", info.Version)
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Printf("%-9s %s\n", key+":", value)
+		}
+	}
+	commit := info.Commit
+	if commit != "" && info.Modified {
+		commit += " " + brightBlack("(modified)")
+	}
+	field("Commit", commit)
+	field("Date", info.Date)
+	field("Go", info.GoVersion)
+	field("Platform", info.Platform)
+}
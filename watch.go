@@ -0,0 +1,189 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long watch waits for events to settle before checking
+// targets, since builds often touch a file several times in quick succession.
+const watchDelay = 200 * time.Millisecond
+
+// watchedTarget is a file that one or more programs depend on: the target of a
+// symlink or the origin of a copy.
+type watchedTarget struct {
+	// Programs that depend on the file.
+	symlinks []string
+	copies   []string
+	// What the file looked like when last checked.
+	exists bool
+	mode   fs.FileMode
+	sum    string
+}
+
+func (c *command) watch(opts *options) {
+	repair := opts.bool('r', "repair")
+	c.validate(opts, anyArgs)
+	targets := c.watchedTargets(opts.args)
+	if len(targets) == 0 {
+		c.fatal("%s: nothing to watch", c.name)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		c.fatal("%s: %s", c.name, err)
+	}
+	defer watcher.Close()
+	dirs := make(map[string]bool)
+	for path, t := range targets {
+		t.snapshot(path)
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			c.error("%s: %s", dir, err)
+		}
+	}
+	fmt.Printf("Watching %d targets %s\n", len(targets), brightBlack("(press Ctrl-C to stop)"))
+	pending := make(map[string]bool)
+	var timer <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if targets[event.Name] != nil {
+				pending[event.Name] = true
+				timer = time.After(watchDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			c.error("%s: %s", c.name, err)
+		case <-timer:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				c.checkTarget(path, targets[path], repair)
+			}
+			pending = make(map[string]bool)
+			timer = nil
+			c.saveState()
+			c.saveJournal()
+		}
+	}
+}
+
+// watchedTargets returns the files that the given programs (or all programs)
+// depend on, keyed by absolute path.
+func (c *command) watchedTargets(names []string) map[string]*watchedTarget {
+	all := len(names) == 0
+	if all {
+		for _, file := range c.files() {
+			if !skip(file) {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	targets := make(map[string]*watchedTarget)
+	get := func(path string) *watchedTarget {
+		t := targets[path]
+		if t == nil {
+			t = &watchedTarget{}
+			targets[path] = t
+		}
+		return t
+	}
+	for _, name := range names {
+		path, info, ok := c.lstatProgram(name)
+		if !ok {
+			continue
+		}
+		if isSymlink(info.Mode()) {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				// Watch for a broken symlink's target to be created.
+				target = ensureAbs(c.bin(), linkTarget(path))
+			}
+			t := get(filepath.Clean(target))
+			t.symlinks = append(t.symlinks, name)
+		} else if p := c.state().lookup(name); p != nil && p.Mode == modeCopy && p.Origin != "" {
+			t := get(p.Origin)
+			t.copies = append(t.copies, name)
+		} else if !all {
+			c.error("%s: not a symlink or a copy with a recorded origin", name)
+		}
+	}
+	return targets
+}
+
+// snapshot records the current state of the target file.
+func (t *watchedTarget) snapshot(path string) {
+	info, err := os.Stat(path)
+	t.exists = err == nil
+	if !t.exists {
+		t.mode, t.sum = 0, ""
+		return
+	}
+	t.mode = info.Mode()
+	t.sum, _ = checksum(path)
+}
+
+// checkTarget reports how a target changed since it was last checked, and
+// repairs the programs that depend on it if requested.
+func (c *command) checkTarget(path string, t *watchedTarget, repair bool) {
+	old := *t
+	t.snapshot(path)
+	programs := strings.Join(append(append([]string(nil), t.symlinks...), t.copies...), ", ")
+	report := func(event, details string) {
+		fmt.Printf("%s %s %s %s%s\n", brightBlack(time.Now().Format("15:04:05")), event, blue(path), brightBlack("("+programs+")"), details)
+	}
+	switch {
+	case old.exists && !t.exists:
+		report(red("Removed"), "")
+		return
+	case !old.exists && t.exists:
+		report("Created", "")
+	case old.sum != t.sum:
+		report("Rebuilt", "")
+	case old.mode != t.mode:
+		report("Changed mode", fmt.Sprintf(" %s %s %s", old.mode.Perm(), brightBlack("->"), t.mode.Perm()))
+	default:
+		return
+	}
+	if !isExecutable(t.mode) {
+		if !repair {
+			c.error("%s: not executable", path)
+		} else if err := os.Chmod(path, t.mode|(t.mode&0o444)>>2); err != nil {
+			c.error("%s: %s", path, err)
+		} else {
+			fmt.Printf("Made %s executable\n", blue(path))
+			t.snapshot(path)
+		}
+	}
+	if t.sum == old.sum || len(t.copies) == 0 {
+		return
+	}
+	for _, name := range t.copies {
+		if repair {
+			c.updateProgram(name, false)
+		} else {
+			fmt.Printf("%s is outdated %s\n", name, brightBlack("(run sim update or use --repair)"))
+		}
+	}
+}
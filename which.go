@@ -0,0 +1,48 @@
+// Copyright 2022 Mitchell Kember. Subject to the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (c *command) which(opts *options) {
+	c.validate(opts, atLeastOneArg)
+	for _, name := range opts.args {
+		c.whichProgram(name)
+	}
+}
+
+// whichProgram prints the file that running name would execute, and whether
+// it is the one in the bin directory.
+func (c *command) whichProgram(name string) {
+	paths := findInPath(name)
+	ours := filepath.Join(c.bin(), name)
+	_, err := os.Stat(ours)
+	haveOurs := err == nil
+	if len(paths) == 0 {
+		if haveOurs {
+			c.error("%s: not found in $PATH (%s is not in $PATH)", name, c.bin())
+		} else {
+			c.error("%s: not found in $PATH", name)
+		}
+		return
+	}
+	var note string
+	switch {
+	case sameDir(filepath.Dir(paths[0]), c.bin()) && c.state().lookup(name) != nil:
+		note = "managed by sim"
+	case sameDir(filepath.Dir(paths[0]), c.bin()):
+		note = "in $XDG_BIN_HOME but not installed by sim"
+	case haveOurs:
+		note = fmt.Sprintf("shadows %s", ours)
+	default:
+		note = "not managed by sim"
+	}
+	fmt.Printf("%s %s\n", paths[0], brightBlack("("+note+")"))
+	if shellBuiltins[name] {
+		fmt.Printf("%s\n", brightBlack(fmt.Sprintf("note: shells run the %s builtin instead", name)))
+	}
+}